@@ -0,0 +1,61 @@
+// i18ncheck reports message ids referenced in the bot source that are missing in a translation,
+// and translated messages that are never referenced.
+//
+// Message ids are collected from string literals assigned to fields ending in MessageID,
+// such as i18n.LocalizeConfig.MessageID or command.descriptionMessageID.
+// Ids computed at runtime are not detected, so always pass them around in such fields.
+//
+// Usage, from the repository root:
+//
+//	go run ./cmd/i18ncheck [source dir]
+//
+// Exits with status 1 if any translation is incomplete.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aybolid/wishbot/internal/locals"
+)
+
+const DEFAULT_SOURCE_DIR = "internal/tgbot"
+
+func main() {
+	dir := DEFAULT_SOURCE_DIR
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	referenced, err := locals.ReferencedMessageIDs(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to collect message ids: %v\n", err)
+		os.Exit(2)
+	}
+
+	reports, err := locals.CheckTranslations(referenced)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check translations: %v\n", err)
+		os.Exit(2)
+	}
+
+	ok := true
+	for _, report := range reports {
+		if report.OK() {
+			fmt.Printf("%s: ok\n", report.Language)
+			continue
+		}
+
+		ok = false
+		for _, id := range report.Missing {
+			fmt.Printf("%s: missing %s\n", report.Language, id)
+		}
+		for _, id := range report.Unused {
+			fmt.Printf("%s: unused %s\n", report.Language, id)
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -1 +1 @@
-env MODE=dev $(cat .env | xargs) go run main.go
\ No newline at end of file
+env MODE=dev $(cat .env | xargs) go run -tags sqlite_fts5 main.go
\ No newline at end of file
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+type dbAdminAction struct {
+	ActionID  int64  `db:"action_id"`
+	AdminID   int64  `db:"admin_id"`
+	Action    string `db:"action"`
+	Args      string `db:"args"`
+	CreatedAt string `db:"created_at"`
+}
+
+type AdminAction struct {
+	ActionID int64
+	AdminID  int64
+	Action   string
+	// Args are the arguments of the action, formatted like "group_id=1 group_name=Family".
+	Args      string
+	CreatedAt string
+}
+
+// RecordAdminAction stores an action of a bot operator.
+func RecordAdminAction(adminID int64, action string, args string) error {
+	logger.Sugared.Infow("recording admin action", "admin_id", adminID, "action", action)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	insertQuery := "INSERT INTO admin_actions (admin_id, action, args) VALUES (?, ?, ?)"
+	if _, err := tx.Exec(insertQuery, adminID, action, args); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAdminActions returns the latest actions of bot operators, newest first.
+func GetAdminActions(limit int) ([]*AdminAction, error) {
+	logger.Sugared.Infow("getting admin actions", "limit", limit)
+
+	var dbActions []dbAdminAction
+
+	query := "SELECT * FROM admin_actions ORDER BY action_id DESC LIMIT ?"
+	if err := Database.Select(&dbActions, query, limit); err != nil {
+		return nil, err
+	}
+
+	actions := make([]*AdminAction, len(dbActions))
+	for i, dba := range dbActions {
+		actions[i] = dba.toAdminAction()
+	}
+
+	return actions, nil
+}
+
+func (dba *dbAdminAction) toAdminAction() *AdminAction {
+	return &AdminAction{
+		ActionID:  dba.ActionID,
+		AdminID:   dba.AdminID,
+		Action:    dba.Action,
+		Args:      dba.Args,
+		CreatedAt: dba.CreatedAt,
+	}
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Audit event types.
+const (
+	AUDIT_MEMBER_JOINED         = "member_joined"
+	AUDIT_MEMBER_LEFT           = "member_left"
+	AUDIT_MEMBER_KICKED         = "member_kicked"
+	AUDIT_WISH_CREATED          = "wish_created"
+	AUDIT_WISH_DELETED          = "wish_deleted"
+	AUDIT_WISH_UPDATED          = "wish_updated"
+	AUDIT_OWNERSHIP_TRANSFERRED = "ownership_transferred"
+)
+
+type dbAuditEvent struct {
+	EventID   int64         `db:"event_id"`
+	GroupID   int64         `db:"group_id"`
+	ActorID   sql.NullInt64 `db:"actor_id"`
+	SubjectID sql.NullInt64 `db:"subject_id"`
+	EventType string        `db:"event_type"`
+	Details   string        `db:"details"`
+	CreatedAt string        `db:"created_at"`
+}
+
+type AuditEvent struct {
+	EventID int64
+	GroupID int64
+	// ActorID is the user who did something. 0 if the user no longer exists.
+	ActorID int64
+	// SubjectID is the user something was done to, e.g. the kicked member.
+	// 0 if there is none or the user no longer exists.
+	SubjectID int64
+	EventType string
+	// Details describe the event, e.g. the url of a deleted wish.
+	Details   string
+	CreatedAt string
+}
+
+// recordEvent stores an audit event as part of the transaction that made the change.
+// Pass 0 as subjectID if nobody else is affected.
+func recordEvent(tx *sqlx.Tx, groupID int64, actorID int64, subjectID int64, eventType string, details string) error {
+	insertQuery := "INSERT INTO audit_events (group_id, actor_id, subject_id, event_type, details) VALUES (?, ?, ?, ?, ?)"
+	_, err := tx.Exec(insertQuery, groupID, nullInt64(actorID), nullInt64(subjectID), eventType, details)
+	return err
+}
+
+// GetGroupEvents retrieves the audit events of a group, most recent first.
+func GetGroupEvents(groupID int64, limit int, offset int) ([]*AuditEvent, error) {
+	logger.Sugared.Infow("getting group events", "group_id", groupID, "limit", limit, "offset", offset)
+
+	var dbEvents []dbAuditEvent
+
+	query := "SELECT * FROM audit_events WHERE group_id = ? ORDER BY created_at DESC, event_id DESC LIMIT ? OFFSET ?"
+	if err := Database.Select(&dbEvents, query, groupID, limit, offset); err != nil {
+		return nil, err
+	}
+
+	events := make([]*AuditEvent, len(dbEvents))
+	for i, dbe := range dbEvents {
+		events[i] = dbe.toAuditEvent()
+	}
+
+	return events, nil
+}
+
+// CountGroupEvents returns the amount of audit events of a group.
+func CountGroupEvents(groupID int64) (int, error) {
+	logger.Sugared.Infow("counting group events", "group_id", groupID)
+
+	var count int
+
+	query := "SELECT COUNT(*) FROM audit_events WHERE group_id = ?"
+	if err := Database.Get(&count, query, groupID); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// nullInt64 stores zero ids as NULL.
+func nullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+func (dbe *dbAuditEvent) toAuditEvent() *AuditEvent {
+	return &AuditEvent{
+		EventID:   dbe.EventID,
+		GroupID:   dbe.GroupID,
+		ActorID:   dbe.ActorID.Int64,
+		SubjectID: dbe.SubjectID.Int64,
+		EventType: dbe.EventType,
+		Details:   dbe.Details,
+		CreatedAt: dbe.CreatedAt,
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+type dbBirthday struct {
+	UserID       int64  `db:"user_id"`
+	Day          int    `db:"day"`
+	Month        int    `db:"month"`
+	Year         int    `db:"year"`
+	RemindedYear int    `db:"reminded_year"`
+	UpdatedAt    string `db:"updated_at"`
+}
+
+type Birthday struct {
+	UserID int64
+	Day    int
+	Month  int
+	// Year is 0 if the user keeps their age to themselves.
+	Year int
+	// RemindedYear is the year of the last birthday group members were reminded about.
+	RemindedYear int
+	UpdatedAt    string
+}
+
+// GetBirthday returns the birthday of a user.
+// Returns sql.ErrNoRows if the user did not share their birthday.
+func GetBirthday(userID int64) (*Birthday, error) {
+	logger.Sugared.Infow("getting birthday", "user_id", userID)
+
+	var dbBirthday dbBirthday
+
+	query := "SELECT * FROM birthdays WHERE user_id = ?"
+	if err := Database.Get(&dbBirthday, query, userID); err != nil {
+		return nil, err
+	}
+
+	return dbBirthday.toBirthday(), nil
+}
+
+// GetAllBirthdays returns every shared birthday.
+func GetAllBirthdays() ([]*Birthday, error) {
+	logger.Sugared.Infow("getting all birthdays")
+
+	var dbBirthdays []dbBirthday
+
+	query := "SELECT * FROM birthdays ORDER BY month, day"
+	if err := Database.Select(&dbBirthdays, query); err != nil {
+		return nil, err
+	}
+
+	birthdays := make([]*Birthday, len(dbBirthdays))
+	for i, dbb := range dbBirthdays {
+		birthdays[i] = dbb.toBirthday()
+	}
+
+	return birthdays, nil
+}
+
+// GetGroupMatesBirthdays returns the birthdays of the users sharing a group with a user.
+// The birthday of the user themselves is left out.
+func GetGroupMatesBirthdays(userID int64) ([]*Birthday, error) {
+	logger.Sugared.Infow("getting group mates birthdays", "user_id", userID)
+
+	var dbBirthdays []dbBirthday
+
+	query := `
+	SELECT * FROM birthdays
+	WHERE user_id != ? AND user_id IN (
+		SELECT gm.user_id FROM group_members gm
+		JOIN group_members own ON own.group_id = gm.group_id
+		WHERE own.user_id = ?
+	)
+	ORDER BY month, day
+	`
+	if err := Database.Select(&dbBirthdays, query, userID, userID); err != nil {
+		return nil, err
+	}
+
+	birthdays := make([]*Birthday, len(dbBirthdays))
+	for i, dbb := range dbBirthdays {
+		birthdays[i] = dbb.toBirthday()
+	}
+
+	return birthdays, nil
+}
+
+// SetBirthday stores the birthday of a user. Pass 0 as year to keep the age private.
+// Changing the date allows members to be reminded about it again.
+func SetBirthday(userID int64, day int, month int, year int) (*Birthday, error) {
+	logger.Sugared.Infow("setting birthday", "user_id", userID, "day", day, "month", month)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	upsertQuery := `
+	INSERT INTO birthdays (user_id, day, month, year) VALUES (?, ?, ?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET
+		reminded_year = CASE WHEN day = excluded.day AND month = excluded.month THEN reminded_year ELSE 0 END,
+		day = excluded.day,
+		month = excluded.month,
+		year = excluded.year,
+		updated_at = datetime('now')
+	`
+	if _, err := tx.Exec(upsertQuery, userID, day, month, year); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var dbBirthday dbBirthday
+	selectQuery := "SELECT * FROM birthdays WHERE user_id = ?"
+	if err := tx.Get(&dbBirthday, selectQuery, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbBirthday.toBirthday(), nil
+}
+
+// DeleteBirthday removes the birthday of a user.
+// Returns false if the user did not share their birthday.
+func DeleteBirthday(userID int64) (bool, error) {
+	logger.Sugared.Infow("deleting birthday", "user_id", userID)
+
+	result, err := Database.Exec("DELETE FROM birthdays WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// MarkBirthdayReminded records that group members were reminded about the birthday of a user in a year.
+// Returns false if they were already reminded, so nobody is reminded twice.
+func MarkBirthdayReminded(userID int64, year int) (bool, error) {
+	logger.Sugared.Infow("marking birthday reminded", "user_id", userID, "year", year)
+
+	query := "UPDATE birthdays SET reminded_year = ? WHERE user_id = ? AND reminded_year < ?"
+	result, err := Database.Exec(query, year, userID, year)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (dbb *dbBirthday) toBirthday() *Birthday {
+	return &Birthday{
+		UserID:       dbb.UserID,
+		Day:          dbb.Day,
+		Month:        dbb.Month,
+		Year:         dbb.Year,
+		RemindedYear: dbb.RemindedYear,
+		UpdatedAt:    dbb.UpdatedAt,
+	}
+}
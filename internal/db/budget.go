@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+)
+
+type dbBudget struct {
+	BudgetID  int64  `db:"budget_id"`
+	UserID    int64  `db:"user_id"`
+	GroupID   int64  `db:"group_id"`
+	Occasion  string `db:"occasion"`
+	Amount    int64  `db:"amount"`
+	Currency  string `db:"currency"`
+	CreatedAt string `db:"created_at"`
+	UpdatedAt string `db:"updated_at"`
+}
+
+type Budget struct {
+	BudgetID int64
+	UserID   int64
+	GroupID  int64
+	// Occasion the budget is for, e.g. "Christmas". Empty for the group as a whole.
+	Occasion  string
+	Amount    money.Amount
+	CreatedAt string
+	UpdatedAt string
+}
+
+type dbPurchase struct {
+	PurchaseID int64         `db:"purchase_id"`
+	UserID     int64         `db:"user_id"`
+	GroupID    int64         `db:"group_id"`
+	WishID     sql.NullInt64 `db:"wish_id"`
+	WishURL    string        `db:"wish_url"`
+	Occasion   string        `db:"occasion"`
+	Amount     int64         `db:"amount"`
+	Currency   string        `db:"currency"`
+	CreatedAt  string        `db:"created_at"`
+}
+
+type Purchase struct {
+	PurchaseID int64
+	UserID     int64
+	GroupID    int64
+	// WishID is 0 if the wish was deleted since.
+	WishID    int64
+	WishURL   string
+	Occasion  string
+	Amount    money.Amount
+	CreatedAt string
+}
+
+// SetBudget sets the budget of a user in a group for an occasion, replacing the previous one.
+func SetBudget(userID int64, groupID int64, occasion string, amount *money.Amount) (*Budget, error) {
+	logger.Sugared.Infow("setting budget", "user_id", userID, "group_id", groupID, "occasion", occasion, "amount", amount.String())
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	upsertQuery := `
+	INSERT INTO budgets (user_id, group_id, occasion, amount, currency) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (user_id, group_id, occasion) DO UPDATE SET
+		amount = excluded.amount,
+		currency = excluded.currency,
+		updated_at = datetime('now')
+	`
+	if _, err := tx.Exec(upsertQuery, userID, groupID, occasion, amount.Value, amount.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var dbb dbBudget
+	selectQuery := "SELECT * FROM budgets WHERE user_id = ? AND group_id = ? AND occasion = ?"
+	if err := tx.Get(&dbb, selectQuery, userID, groupID, occasion); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbb.toBudget(), nil
+}
+
+// DeleteBudget removes the budget of a user in a group for an occasion.
+// Returns false if there was no such budget.
+func DeleteBudget(userID int64, groupID int64, occasion string) (bool, error) {
+	logger.Sugared.Infow("deleting budget", "user_id", userID, "group_id", groupID, "occasion", occasion)
+
+	query := "DELETE FROM budgets WHERE user_id = ? AND group_id = ? AND occasion = ?"
+	result, err := Database.Exec(query, userID, groupID, occasion)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// GetUserBudgets retrieves the budgets of a user in all groups.
+func GetUserBudgets(userID int64) ([]*Budget, error) {
+	logger.Sugared.Infow("getting user budgets", "user_id", userID)
+
+	var dbBudgets []dbBudget
+
+	query := "SELECT * FROM budgets WHERE user_id = ? ORDER BY group_id, occasion"
+	if err := Database.Select(&dbBudgets, query, userID); err != nil {
+		return nil, err
+	}
+
+	budgets := make([]*Budget, len(dbBudgets))
+	for idx, dbb := range dbBudgets {
+		budgets[idx] = dbb.toBudget()
+	}
+
+	return budgets, nil
+}
+
+// CreatePurchase records that a user bought a wish for the given amount.
+// Returns sql.ErrNoRows if the wish does not exist.
+func CreatePurchase(userID int64, wishID int64, occasion string, amount *money.Amount) (*Purchase, error) {
+	logger.Sugared.Infow("creating purchase", "user_id", userID, "wish_id", wishID, "occasion", occasion, "amount", amount.String())
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery := `
+	INSERT INTO purchases (user_id, group_id, wish_id, wish_url, occasion, amount, currency)
+	SELECT ?, group_id, wish_id, url, ?, ?, ? FROM wishes WHERE wish_id = ?
+	`
+	result, err := tx.Exec(insertQuery, userID, occasion, amount.Value, amount.Currency, wishID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// nothing is inserted if the wish was deleted in the meantime
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if affected != 1 {
+		tx.Rollback()
+		return nil, sql.ErrNoRows
+	}
+
+	purchaseID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var dbp dbPurchase
+	selectQuery := "SELECT * FROM purchases WHERE purchase_id = ?"
+	if err := tx.Get(&dbp, selectQuery, purchaseID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbp.toPurchase(), nil
+}
+
+// GetUserPurchases retrieves the purchases of a user in all groups, oldest first.
+func GetUserPurchases(userID int64) ([]*Purchase, error) {
+	logger.Sugared.Infow("getting user purchases", "user_id", userID)
+
+	var dbPurchases []dbPurchase
+
+	query := "SELECT * FROM purchases WHERE user_id = ? ORDER BY created_at, purchase_id"
+	if err := Database.Select(&dbPurchases, query, userID); err != nil {
+		return nil, err
+	}
+
+	purchases := make([]*Purchase, len(dbPurchases))
+	for idx, dbp := range dbPurchases {
+		purchases[idx] = dbp.toPurchase()
+	}
+
+	return purchases, nil
+}
+
+func (dbb *dbBudget) toBudget() *Budget {
+	return &Budget{
+		BudgetID:  dbb.BudgetID,
+		UserID:    dbb.UserID,
+		GroupID:   dbb.GroupID,
+		Occasion:  dbb.Occasion,
+		Amount:    money.Amount{Value: dbb.Amount, Currency: dbb.Currency},
+		CreatedAt: dbb.CreatedAt,
+		UpdatedAt: dbb.UpdatedAt,
+	}
+}
+
+func (dbp *dbPurchase) toPurchase() *Purchase {
+	return &Purchase{
+		PurchaseID: dbp.PurchaseID,
+		UserID:     dbp.UserID,
+		GroupID:    dbp.GroupID,
+		WishID:     dbp.WishID.Int64,
+		WishURL:    dbp.WishURL,
+		Occasion:   dbp.Occasion,
+		Amount:     money.Amount{Value: dbp.Amount, Currency: dbp.Currency},
+		CreatedAt:  dbp.CreatedAt,
+	}
+}
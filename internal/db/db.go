@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"fmt"
 	"os"
 
 	"github.com/aybolid/wishbot/internal/logger"
@@ -11,6 +13,9 @@ import (
 const DB_DIR = "data"
 const DB_FILE = "wishbot.db"
 
+// TIME_LAYOUT is the layout of timestamps made by sqlite datetime('now'), always in UTC.
+const TIME_LAYOUT = "2006-01-02 15:04:05"
+
 var Database *sqlx.DB
 
 // Initializes the database connection.
@@ -23,7 +28,8 @@ func Init() {
 
 	dbPath := DB_DIR + "/" + DB_FILE
 
-	Database, err = sqlx.Open("sqlite3", dbPath)
+	// foreign keys are enabled per connection, deletions rely on them to cascade
+	Database, err = sqlx.Open("sqlite3", dbPath+"?_foreign_keys=on")
 	if err != nil {
 		panic(err)
 	}
@@ -35,6 +41,7 @@ func Init() {
 	logger.Sugared.Infow("connected to database", "path", dbPath)
 
 	runStartupMigrations()
+	initSearch()
 }
 
 var schema = `
@@ -88,9 +95,296 @@ CREATE TABLE IF NOT EXISTS wishes (
     FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE,
 	FOREIGN KEY(member_id) REFERENCES group_members(member_id) ON DELETE CASCADE
 );
+
+-- Wish pools table. A pool tracks a shared target price for an expensive wish.
+CREATE TABLE IF NOT EXISTS wish_pools (
+	wish_id INTEGER PRIMARY KEY,
+	created_by INTEGER,
+	target_amount INTEGER NOT NULL, -- minor units
+	currency TEXT NOT NULL,
+	reached_at TEXT,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(wish_id) REFERENCES wishes(wish_id) ON DELETE CASCADE,
+	FOREIGN KEY(created_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+-- Wish contributions table. Members pledge an amount towards a wish pool.
+CREATE TABLE IF NOT EXISTS wish_contributions (
+	contribution_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	wish_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL, -- minor units
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(wish_id) REFERENCES wish_pools(wish_id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS wish_contributions_unique_idx ON wish_contributions (wish_id, user_id);
+
+-- Audit events table. Records who did what in a group.
+CREATE TABLE IF NOT EXISTS audit_events (
+	event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id INTEGER NOT NULL,
+	actor_id INTEGER, -- NULL if the user no longer exists
+	subject_id INTEGER, -- user affected by the event, NULL if none or the user no longer exists
+	event_type TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(group_id) REFERENCES groups(group_id) ON DELETE CASCADE,
+	FOREIGN KEY(actor_id) REFERENCES users(user_id) ON DELETE SET NULL,
+	FOREIGN KEY(subject_id) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_group_idx ON audit_events (group_id, created_at);
+
+-- Wish prices table. The price history of wishes linking to product pages.
+-- A row is added whenever the price changes, checked_at is bumped while it stays the same.
+CREATE TABLE IF NOT EXISTS wish_prices (
+	price_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	wish_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL, -- minor units
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	checked_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(wish_id) REFERENCES wishes(wish_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS wish_prices_wish_idx ON wish_prices (wish_id, price_id);
+
+-- Wish links table. The result of the latest check of a wish url.
+CREATE TABLE IF NOT EXISTS wish_links (
+	wish_id INTEGER PRIMARY KEY,
+	status TEXT NOT NULL, -- see linkcheck statuses
+	status_code INTEGER NOT NULL DEFAULT 0, -- 0 if the page could not be reached
+	final_url TEXT NOT NULL DEFAULT '', -- url after redirects
+	checked_at TEXT NOT NULL DEFAULT (datetime('now')),
+	notified_status TEXT, -- status the owner was last told about, NULL if none
+	FOREIGN KEY(wish_id) REFERENCES wishes(wish_id) ON DELETE CASCADE
+);
+
+-- Budgets table. How much a member plans to spend on gifts in a group, optionally for an occasion.
+CREATE TABLE IF NOT EXISTS budgets (
+	budget_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	group_id INTEGER NOT NULL,
+	occasion TEXT NOT NULL DEFAULT '' COLLATE NOCASE, -- empty for the group as a whole
+	amount INTEGER NOT NULL, -- minor units
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY(group_id) REFERENCES groups(group_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS budgets_unique_idx ON budgets (user_id, group_id, occasion);
+
+-- Purchases table. Gifts members bought, counted against their budgets.
+-- Purchases are private to the buyer, gifts are a surprise.
+CREATE TABLE IF NOT EXISTS purchases (
+	purchase_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	group_id INTEGER NOT NULL,
+	wish_id INTEGER, -- NULL once the wish is deleted
+	wish_url TEXT NOT NULL, -- kept after the wish is deleted
+	occasion TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+	amount INTEGER NOT NULL, -- minor units
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY(group_id) REFERENCES groups(group_id) ON DELETE CASCADE,
+	FOREIGN KEY(wish_id) REFERENCES wishes(wish_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS purchases_user_idx ON purchases (user_id, group_id);
+
+-- Deferred messages table. Notifications held back until the quiet hours of the user end.
+CREATE TABLE IF NOT EXISTS deferred_messages (
+	message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	parse_mode TEXT NOT NULL DEFAULT '',
+	disable_preview INTEGER NOT NULL DEFAULT 0,
+	reply_markup TEXT NOT NULL DEFAULT '', -- json encoded inline keyboard, empty if none
+	send_after TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS deferred_messages_send_after_idx ON deferred_messages (send_after);
+
+-- Birthdays table. Birthdays members chose to share with their groups.
+CREATE TABLE IF NOT EXISTS birthdays (
+	user_id INTEGER PRIMARY KEY,
+	day INTEGER NOT NULL,
+	month INTEGER NOT NULL,
+	year INTEGER NOT NULL DEFAULT 0, -- 0 if the user keeps their age to themselves
+	reminded_year INTEGER NOT NULL DEFAULT 0, -- year of the last birthday members were reminded about
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Wish templates table. Reusable notes members attach to groups, e.g. their clothing sizes.
+CREATE TABLE IF NOT EXISTS wish_templates (
+	template_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Template groups table. The groups a wish template is shown in.
+CREATE TABLE IF NOT EXISTS template_groups (
+	template_id INTEGER NOT NULL,
+	group_id INTEGER NOT NULL,
+	PRIMARY KEY(template_id, group_id),
+	FOREIGN KEY(template_id) REFERENCES wish_templates(template_id) ON DELETE CASCADE,
+	FOREIGN KEY(group_id) REFERENCES groups(group_id) ON DELETE CASCADE
+);
+
+-- Profiles table. Sizes and preferences a user shares with their groups, empty values are not set.
+CREATE TABLE IF NOT EXISTS profiles (
+	user_id INTEGER PRIMARY KEY,
+	clothing_size TEXT NOT NULL DEFAULT '',
+	shoe_size TEXT NOT NULL DEFAULT '',
+	ring_size TEXT NOT NULL DEFAULT '',
+	favorite_colors TEXT NOT NULL DEFAULT '',
+	allergies TEXT NOT NULL DEFAULT '',
+	dislikes TEXT NOT NULL DEFAULT '',
+	updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Admin actions table. Everything bot operators did with admin commands, including denied attempts.
+CREATE TABLE IF NOT EXISTS admin_actions (
+	action_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	admin_id INTEGER NOT NULL, -- not a foreign key, the log outlives the account
+	action TEXT NOT NULL,
+	args TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Notification settings table. How members want to hear about wish changes in a group.
+-- Members without a row are notified instantly.
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id INTEGER NOT NULL,
+	group_id INTEGER NOT NULL,
+	mode TEXT NOT NULL, -- see notification modes
+	digest_event_id INTEGER NOT NULL DEFAULT 0, -- last audit event covered by a digest
+	digest_sent_at TEXT NOT NULL DEFAULT (datetime('now')),
+	PRIMARY KEY(user_id, group_id),
+	FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY(group_id) REFERENCES groups(group_id) ON DELETE CASCADE
+);
 `
 
+// migrations alter the schema of databases created before a change.
+// They run in order on top of the base schema, the amount of applied migrations
+// is tracked in PRAGMA user_version. Never edit or reorder existing entries.
+var migrations = []string{
+	// 1: bind groups to telegram group chats.
+	`
+	ALTER TABLE groups ADD COLUMN chat_id INTEGER;
+	CREATE UNIQUE INDEX IF NOT EXISTS groups_chat_id_unique_idx ON groups (chat_id);
+	`,
+	// 2: allow users without a username and store their names.
+	// SQLite can't drop NOT NULL constraints, so the users table is rebuilt.
+	`
+	CREATE TABLE users_new (
+		user_id INTEGER PRIMARY KEY, -- telegram user id
+		username TEXT UNIQUE COLLATE NOCASE, -- NULL for users without a username
+		first_name TEXT NOT NULL DEFAULT '',
+		last_name TEXT,
+		chat_id INTEGER NOT NULL UNIQUE,
+		language TEXT NOT NULL DEFAULT 'en',
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	INSERT INTO users_new (user_id, username, chat_id, language, created_at, updated_at)
+		SELECT user_id, NULLIF(username, ''), chat_id, language, created_at, updated_at FROM users;
+	DROP TABLE users;
+	ALTER TABLE users_new RENAME TO users;
+	`,
+	// 3: let members rank their wishes. Positions start from the oldest wish of each member's list.
+	`
+	ALTER TABLE wishes ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	UPDATE wishes SET position = (
+		SELECT COUNT(*) FROM wishes w
+		WHERE w.group_id = wishes.group_id AND w.user_id = wishes.user_id
+		AND (w.created_at < wishes.created_at OR (w.created_at = wishes.created_at AND w.wish_id < wishes.wish_id))
+	);
+	CREATE INDEX IF NOT EXISTS wishes_position_idx ON wishes (group_id, user_id, position);
+	`,
+	// 4: timezones and quiet hours of users.
+	`
+	ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+	ALTER TABLE users ADD COLUMN quiet_start INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN quiet_end INTEGER NOT NULL DEFAULT 0;
+	`,
+}
+
 func runStartupMigrations() {
 	Database.MustExec(schema)
-	logger.Sugared.Infow("ran startup migrations")
+
+	// migrations may rebuild tables, dropping a table with foreign keys enabled would cascade.
+	// Foreign keys can't be toggled inside a transaction, so migrations run on a dedicated connection.
+	ctx := context.Background()
+	conn, err := Database.Connx(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.GetContext(ctx, &version, "PRAGMA user_version"); err != nil {
+		panic(err)
+	}
+
+	if version < len(migrations) {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			panic(err)
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			panic(err)
+		}
+		tx.MustExec(migrations[version])
+		logForeignKeyViolations(tx)
+		tx.MustExec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		if err := tx.Commit(); err != nil {
+			panic(err)
+		}
+		logger.Sugared.Infow("applied migration", "version", version+1)
+	}
+
+	logger.Sugared.Infow("ran startup migrations", "version", version)
+}
+
+// logForeignKeyViolations logs rows referencing missing rows after a migration.
+// Foreign keys are not enforced during migrations, so they are checked explicitly.
+// Violations are not fatal, since databases may have them from before foreign keys were enforced.
+func logForeignKeyViolations(tx *sqlx.Tx) {
+	rows, err := tx.Queryx("PRAGMA foreign_key_check")
+	if err != nil {
+		logger.Sugared.Errorw("failed to check foreign keys", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		violation := map[string]any{}
+		if err := rows.MapScan(violation); err != nil {
+			logger.Sugared.Errorw("failed to scan foreign key violation", "err", err)
+			return
+		}
+		logger.Sugared.Warnw("foreign key violation", "violation", violation)
+	}
 }
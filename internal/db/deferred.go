@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+type dbDeferredMessage struct {
+	MessageID      int64  `db:"message_id"`
+	UserID         int64  `db:"user_id"`
+	Text           string `db:"text"`
+	ParseMode      string `db:"parse_mode"`
+	DisablePreview bool   `db:"disable_preview"`
+	ReplyMarkup    string `db:"reply_markup"`
+	SendAfter      string `db:"send_after"`
+	CreatedAt      string `db:"created_at"`
+}
+
+type DeferredMessage struct {
+	MessageID      int64
+	UserID         int64
+	Text           string
+	ParseMode      string
+	DisablePreview bool
+	// ReplyMarkup is the json encoded inline keyboard of the message, empty if none.
+	ReplyMarkup string
+	SendAfter   string
+	CreatedAt   string
+}
+
+// DeferMessage stores a message to be sent to a user once sendAfter has passed.
+func DeferMessage(userID int64, text string, parseMode string, disablePreview bool, replyMarkup string, sendAfter time.Time) error {
+	logger.Sugared.Infow("deferring message", "user_id", userID, "send_after", sendAfter)
+
+	insertQuery := `
+	INSERT INTO deferred_messages (user_id, text, parse_mode, disable_preview, reply_markup, send_after)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := Database.Exec(insertQuery, userID, text, parseMode, disablePreview, replyMarkup, formatTime(sendAfter))
+	return err
+}
+
+// GetDueMessages returns the deferred messages that may be sent at now, oldest first.
+func GetDueMessages(now time.Time) ([]*DeferredMessage, error) {
+	logger.Sugared.Infow("getting due messages")
+
+	var dbMessages []dbDeferredMessage
+
+	query := "SELECT * FROM deferred_messages WHERE send_after <= ? ORDER BY message_id"
+	if err := Database.Select(&dbMessages, query, formatTime(now)); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*DeferredMessage, len(dbMessages))
+	for i, dbm := range dbMessages {
+		messages[i] = dbm.toDeferredMessage()
+	}
+
+	return messages, nil
+}
+
+// DeleteDeferredMessage removes a deferred message once it was sent.
+func DeleteDeferredMessage(messageID int64) error {
+	logger.Sugared.Infow("deleting deferred message", "message_id", messageID)
+
+	_, err := Database.Exec("DELETE FROM deferred_messages WHERE message_id = ?", messageID)
+	return err
+}
+
+// ParseTime parses a stored timestamp.
+func ParseTime(value string) (time.Time, error) {
+	return time.ParseInLocation(TIME_LAYOUT, value, time.UTC)
+}
+
+// formatTime formats a time like sqlite datetime('now'), so stored timestamps compare as text.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(TIME_LAYOUT)
+}
+
+func (dbm *dbDeferredMessage) toDeferredMessage() *DeferredMessage {
+	return &DeferredMessage{
+		MessageID:      dbm.MessageID,
+		UserID:         dbm.UserID,
+		Text:           dbm.Text,
+		ParseMode:      dbm.ParseMode,
+		DisablePreview: dbm.DisablePreview,
+		ReplyMarkup:    dbm.ReplyMarkup,
+		SendAfter:      dbm.SendAfter,
+		CreatedAt:      dbm.CreatedAt,
+	}
+}
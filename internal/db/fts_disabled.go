@@ -0,0 +1,6 @@
+//go:build !(sqlite_fts5 || fts5)
+
+package db
+
+// ftsEnabled is set if the sqlite driver is built with FTS5, see search.go.
+const ftsEnabled = false
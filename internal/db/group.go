@@ -1,19 +1,26 @@
 package db
 
-import "github.com/aybolid/wishbot/internal/logger"
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
 
 type dbGroup struct {
-	GroupID   int64  `db:"group_id"`
-	Name      string `db:"name"`
-	OwnerID   int64  `db:"owner_id"`
-	CreatedAt string `db:"created_at"`
-	UpdatedAt string `db:"updated_at"`
+	GroupID   int64         `db:"group_id"`
+	Name      string        `db:"name"`
+	OwnerID   int64         `db:"owner_id"`
+	ChatID    sql.NullInt64 `db:"chat_id"`
+	CreatedAt string        `db:"created_at"`
+	UpdatedAt string        `db:"updated_at"`
 }
 
 type Group struct {
-	GroupID   int64
-	Name      string
-	OwnerID   int64
+	GroupID int64
+	Name    string
+	OwnerID int64
+	// ChatID of the telegram group chat the group is bound to. 0 if the group is not bound.
+	ChatID    int64
 	CreatedAt string
 	UpdatedAt string
 }
@@ -55,6 +62,20 @@ func GetGroup(groupID int64) (*Group, error) {
 	return dbGroup.toGroup(), nil
 }
 
+// GetGroupByChatID returns the group bound to a telegram group chat.
+func GetGroupByChatID(chatID int64) (*Group, error) {
+	logger.Sugared.Infow("getting group by chat id", "chat_id", chatID)
+
+	var dbGroup dbGroup
+
+	query := "SELECT * FROM groups WHERE chat_id = ?"
+	if err := Database.Get(&dbGroup, query, chatID); err != nil {
+		return nil, err
+	}
+
+	return dbGroup.toGroup(), nil
+}
+
 // GetOwnedGroups retrieves all groups owned by a given user.
 func GetOwnedGroups(ownerID int64) ([]*Group, error) {
 	logger.Sugared.Infow("getting owned groups", "owner_id", ownerID)
@@ -117,12 +138,109 @@ func CreateGroup(ownerID int64, name string) (*Group, error) {
 	return dbg.toGroup(), nil
 }
 
+// BindGroupChat binds a group to a telegram group chat.
+// A chat can only be bound to one group, so any previous binding of the chat is removed.
+func BindGroupChat(groupID int64, chatID int64) error {
+	logger.Sugared.Infow("binding group chat", "group_id", groupID, "chat_id", chatID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	unbindQuery := "UPDATE groups SET chat_id = NULL, updated_at = datetime('now') WHERE chat_id = ?"
+	if _, err := tx.Exec(unbindQuery, chatID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	bindQuery := "UPDATE groups SET chat_id = ?, updated_at = datetime('now') WHERE group_id = ?"
+	if _, err := tx.Exec(bindQuery, chatID, groupID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes a group along with its members and wishes.
+func DeleteGroup(groupID int64) error {
+	logger.Sugared.Infow("deleting group", "group_id", groupID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := "DELETE FROM groups WHERE group_id = ?"
+	if _, err := tx.Exec(deleteQuery, groupID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnbindGroupChat removes the binding of a telegram group chat.
+func UnbindGroupChat(chatID int64) error {
+	logger.Sugared.Infow("unbinding group chat", "chat_id", chatID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	unbindQuery := "UPDATE groups SET chat_id = NULL, updated_at = datetime('now') WHERE chat_id = ?"
+	if _, err := tx.Exec(unbindQuery, chatID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateGroupChat moves a binding to a new chat id.
+// Telegram changes the chat id when a group is upgraded to a supergroup.
+func MigrateGroupChat(oldChatID int64, newChatID int64) error {
+	logger.Sugared.Infow("migrating group chat", "old_chat_id", oldChatID, "new_chat_id", newChatID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	updateQuery := "UPDATE groups SET chat_id = ?, updated_at = datetime('now') WHERE chat_id = ?"
+	if _, err := tx.Exec(updateQuery, newChatID, oldChatID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // toGroup converts a dbGroup to a Group.
 func (dbg *dbGroup) toGroup() *Group {
 	return &Group{
 		GroupID:   dbg.GroupID,
 		Name:      dbg.Name,
 		OwnerID:   dbg.OwnerID,
+		ChatID:    dbg.ChatID.Int64,
 		CreatedAt: dbg.CreatedAt,
 		UpdatedAt: dbg.UpdatedAt,
 	}
@@ -1,6 +1,9 @@
 package db
 
-import "github.com/aybolid/wishbot/internal/logger"
+import (
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/jmoiron/sqlx"
+)
 
 type dbGroupMember struct {
 	MemberID  int64  `db:"member_id"`
@@ -18,12 +21,12 @@ type GroupMember struct {
 	UpdatedAt string
 }
 
-// GetGroupMembers retrieves all members of a given group.
+// GetGroupMembers retrieves all members of a given group, ordered by user id.
 func GetGroupMembers(groupID int64) ([]*GroupMember, error) {
 	logger.Sugared.Infow("getting group members", "group_id", groupID)
 
 	var dbMembers []dbGroupMember
-	query := "SELECT * FROM group_members WHERE group_id = ?"
+	query := "SELECT * FROM group_members WHERE group_id = ? ORDER BY user_id"
 	if err := Database.Select(&dbMembers, query, groupID); err != nil {
 		return nil, err
 	}
@@ -66,6 +69,11 @@ func CreateGroupMember(groupID int64, userID int64) (*GroupMember, error) {
 		return nil, err
 	}
 
+	if err := recordEvent(tx, groupID, userID, 0, AUDIT_MEMBER_JOINED, ""); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	dbm := &dbGroupMember{}
 	selectQuery := "SELECT * FROM group_members WHERE group_id = ? AND user_id = ?"
 	if err := tx.Get(dbm, selectQuery, groupID, userID); err != nil {
@@ -80,9 +88,28 @@ func CreateGroupMember(groupID int64, userID int64) (*GroupMember, error) {
 	return dbm.toGroupMember(), nil
 }
 
-// DeleteGroupMember deletes a group member and all associated wishes.
+// GetGroupSuccessor returns the member that takes over a group if its owner leaves for good.
+// That is the member who joined the group first. Returns sql.ErrNoRows if the owner is the only member.
+func GetGroupSuccessor(groupID int64, ownerID int64) (*GroupMember, error) {
+	logger.Sugared.Infow("getting group successor", "group_id", groupID, "owner_id", ownerID)
+	return getGroupSuccessor(Database, groupID, ownerID)
+}
+
+func getGroupSuccessor(q sqlx.Queryer, groupID int64, ownerID int64) (*GroupMember, error) {
+	var dbMember dbGroupMember
+
+	query := "SELECT * FROM group_members WHERE group_id = ? AND user_id != ? ORDER BY created_at, member_id LIMIT 1"
+	if err := sqlx.Get(q, &dbMember, query, groupID, ownerID); err != nil {
+		return nil, err
+	}
+
+	return dbMember.toGroupMember(), nil
+}
+
+// DeleteGroupMember deletes a group member, all associated wishes and their pledges to wishes of the group.
+// The actor is the user removing the member, a member leaves if the actor is the member itself.
 // NOTE: If the user is the owner of the group, the group and all related data will be deleted.
-func DeleteGroupMember(groupID int64, userID int64) error {
+func DeleteGroupMember(groupID int64, userID int64, actorID int64) error {
 	group, err := GetGroup(groupID)
 	if err != nil {
 		return err
@@ -107,6 +134,31 @@ func DeleteGroupMember(groupID int64, userID int64) error {
 			tx.Rollback()
 			return err
 		}
+
+		// pledges of a former member would never be paid, so they must not count towards pools
+		deleteContributionsQuery := "DELETE FROM wish_contributions WHERE user_id = ? AND wish_id IN (SELECT wish_id FROM wishes WHERE group_id = ?)"
+		if _, err := tx.Exec(deleteContributionsQuery, userID, groupID); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// former members must not keep getting digests of the group
+		deleteSettingsQuery := "DELETE FROM notification_settings WHERE group_id = ? AND user_id = ?"
+		if _, err := tx.Exec(deleteSettingsQuery, groupID, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		var eventErr error
+		if actorID == userID {
+			eventErr = recordEvent(tx, groupID, userID, 0, AUDIT_MEMBER_LEFT, "")
+		} else {
+			eventErr = recordEvent(tx, groupID, actorID, userID, AUDIT_MEMBER_KICKED, "")
+		}
+		if eventErr != nil {
+			tx.Rollback()
+			return eventErr
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
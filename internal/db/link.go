@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+type dbWishLink struct {
+	WishID         int64          `db:"wish_id"`
+	Status         string         `db:"status"`
+	StatusCode     int            `db:"status_code"`
+	FinalURL       string         `db:"final_url"`
+	CheckedAt      string         `db:"checked_at"`
+	NotifiedStatus sql.NullString `db:"notified_status"`
+}
+
+type WishLink struct {
+	WishID int64
+	// Status is the result of the latest check, see linkcheck statuses.
+	Status string
+	// StatusCode is the http status of the page, 0 if it could not be reached.
+	StatusCode int
+	// FinalURL is the url the link redirected to.
+	FinalURL  string
+	CheckedAt string
+	// NotifiedStatus is the status the wish owner was last told about, empty if none.
+	NotifiedStatus string
+}
+
+// GetWishLink returns the latest link check of a wish.
+// Returns sql.ErrNoRows if the link was not checked yet.
+func GetWishLink(wishID int64) (*WishLink, error) {
+	logger.Sugared.Infow("getting wish link", "wish_id", wishID)
+
+	var dbLink dbWishLink
+
+	query := "SELECT * FROM wish_links WHERE wish_id = ?"
+	if err := Database.Get(&dbLink, query, wishID); err != nil {
+		return nil, err
+	}
+
+	return dbLink.toWishLink(), nil
+}
+
+// RecordLinkCheck stores the result of checking the url of a wish.
+// Once the link is healthy again the owner may be notified about future problems.
+func RecordLinkCheck(wishID int64, status string, statusCode int, finalURL string, healthy bool) error {
+	logger.Sugared.Infow("recording link check", "wish_id", wishID, "status", status, "status_code", statusCode)
+
+	query := `
+	INSERT INTO wish_links (wish_id, status, status_code, final_url) VALUES (?, ?, ?, ?)
+	ON CONFLICT (wish_id) DO UPDATE SET
+		status = excluded.status,
+		status_code = excluded.status_code,
+		final_url = excluded.final_url,
+		checked_at = datetime('now'),
+		notified_status = CASE WHEN ? THEN NULL ELSE notified_status END
+	`
+	_, err := Database.Exec(query, wishID, status, statusCode, finalURL, healthy)
+	return err
+}
+
+// MarkLinkNotified records that the wish owner was told about the current link status.
+// Returns false if the owner was already told about it, so nobody is notified twice.
+func MarkLinkNotified(wishID int64, status string) (bool, error) {
+	logger.Sugared.Infow("marking link notified", "wish_id", wishID, "status", status)
+
+	query := "UPDATE wish_links SET notified_status = ? WHERE wish_id = ? AND notified_status IS NOT ?"
+	result, err := Database.Exec(query, status, wishID, status)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (dbl *dbWishLink) toWishLink() *WishLink {
+	return &WishLink{
+		WishID:         dbl.WishID,
+		Status:         dbl.Status,
+		StatusCode:     dbl.StatusCode,
+		FinalURL:       dbl.FinalURL,
+		CheckedAt:      dbl.CheckedAt,
+		NotifiedStatus: dbl.NotifiedStatus.String,
+	}
+}
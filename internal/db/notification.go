@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+// Notification modes, how a member hears about wish changes in a group.
+const (
+	NOTIFY_INSTANT = "instant"
+	NOTIFY_DAILY   = "daily"
+	NOTIFY_WEEKLY  = "weekly"
+	NOTIFY_OFF     = "off"
+)
+
+// NotificationModes lists the notification modes in the order they are offered.
+var NotificationModes = []string{NOTIFY_INSTANT, NOTIFY_DAILY, NOTIFY_WEEKLY, NOTIFY_OFF}
+
+type dbNotificationSetting struct {
+	UserID        int64  `db:"user_id"`
+	GroupID       int64  `db:"group_id"`
+	Mode          string `db:"mode"`
+	DigestEventID int64  `db:"digest_event_id"`
+	DigestSentAt  string `db:"digest_sent_at"`
+}
+
+type NotificationSetting struct {
+	UserID  int64
+	GroupID int64
+	Mode    string
+	// DigestEventID is the last audit event covered by a digest.
+	DigestEventID int64
+	// DigestSentAt is when the last digest was sent, or when the member switched to a digest.
+	DigestSentAt string
+}
+
+// GetNotificationMode returns how a member wants to hear about wish changes in a group.
+func GetNotificationMode(userID int64, groupID int64) (string, error) {
+	logger.Sugared.Infow("getting notification mode", "user_id", userID, "group_id", groupID)
+
+	var mode string
+
+	query := "SELECT mode FROM notification_settings WHERE user_id = ? AND group_id = ?"
+	err := Database.Get(&mode, query, userID, groupID)
+	if err == sql.ErrNoRows {
+		return NOTIFY_INSTANT, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return mode, nil
+}
+
+// SetNotificationMode changes how a member hears about wish changes in a group.
+// Switching to a digest from another mode starts the digest at the current events,
+// switching between digests keeps the events that were not sent yet.
+func SetNotificationMode(userID int64, groupID int64, mode string) error {
+	logger.Sugared.Infow("setting notification mode", "user_id", userID, "group_id", groupID, "mode", mode)
+
+	query := `
+	INSERT INTO notification_settings (user_id, group_id, mode, digest_event_id)
+	VALUES (?, ?, ?, (SELECT COALESCE(MAX(event_id), 0) FROM audit_events WHERE group_id = ?))
+	ON CONFLICT (user_id, group_id) DO UPDATE SET
+		digest_event_id = CASE WHEN mode IN (?, ?) THEN digest_event_id ELSE excluded.digest_event_id END,
+		digest_sent_at = CASE WHEN mode IN (?, ?) THEN digest_sent_at ELSE excluded.digest_sent_at END,
+		mode = excluded.mode
+	`
+	_, err := Database.Exec(query, userID, groupID, mode, groupID, NOTIFY_DAILY, NOTIFY_WEEKLY, NOTIFY_DAILY, NOTIFY_WEEKLY)
+	return err
+}
+
+// GetDigestSettings returns the settings of all members receiving daily or weekly digests.
+// Settings left behind by former members are skipped.
+func GetDigestSettings() ([]*NotificationSetting, error) {
+	logger.Sugared.Infow("getting digest settings")
+
+	var dbSettings []dbNotificationSetting
+
+	query := `
+	SELECT ns.* FROM notification_settings ns
+	JOIN group_members gm ON gm.group_id = ns.group_id AND gm.user_id = ns.user_id
+	WHERE ns.mode IN (?, ?)
+	`
+	if err := Database.Select(&dbSettings, query, NOTIFY_DAILY, NOTIFY_WEEKLY); err != nil {
+		return nil, err
+	}
+
+	settings := make([]*NotificationSetting, len(dbSettings))
+	for i, dbs := range dbSettings {
+		settings[i] = dbs.toNotificationSetting()
+	}
+
+	return settings, nil
+}
+
+// GetDigestEvents returns the wish changes in a group after an audit event, oldest first.
+// Changes made by the member themselves are left out.
+func GetDigestEvents(groupID int64, userID int64, afterEventID int64) ([]*AuditEvent, error) {
+	logger.Sugared.Infow("getting digest events", "group_id", groupID, "user_id", userID, "after_event_id", afterEventID)
+
+	var dbEvents []dbAuditEvent
+
+	query := `
+	SELECT * FROM audit_events
+	WHERE group_id = ? AND event_id > ? AND event_type IN (?, ?, ?) AND (actor_id IS NULL OR actor_id != ?)
+	ORDER BY event_id
+	`
+	err := Database.Select(&dbEvents, query, groupID, afterEventID, AUDIT_WISH_CREATED, AUDIT_WISH_UPDATED, AUDIT_WISH_DELETED, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*AuditEvent, len(dbEvents))
+	for i, dbe := range dbEvents {
+		events[i] = dbe.toAuditEvent()
+	}
+
+	return events, nil
+}
+
+// MarkDigestSent records that a member got a digest covering the events up to lastEventID.
+func MarkDigestSent(userID int64, groupID int64, lastEventID int64) error {
+	logger.Sugared.Infow("marking digest sent", "user_id", userID, "group_id", groupID, "last_event_id", lastEventID)
+
+	query := `
+	UPDATE notification_settings SET digest_event_id = MAX(digest_event_id, ?), digest_sent_at = datetime('now')
+	WHERE user_id = ? AND group_id = ?
+	`
+	_, err := Database.Exec(query, lastEventID, userID, groupID)
+	return err
+}
+
+// MarkDigestEventsSent records that a member got the events up to lastEventID, without marking the digest sent.
+// The rest of the events go out on the next check.
+func MarkDigestEventsSent(userID int64, groupID int64, lastEventID int64) error {
+	logger.Sugared.Infow("marking digest events sent", "user_id", userID, "group_id", groupID, "last_event_id", lastEventID)
+
+	query := "UPDATE notification_settings SET digest_event_id = MAX(digest_event_id, ?) WHERE user_id = ? AND group_id = ?"
+	_, err := Database.Exec(query, lastEventID, userID, groupID)
+	return err
+}
+
+func (dbs *dbNotificationSetting) toNotificationSetting() *NotificationSetting {
+	return &NotificationSetting{
+		UserID:        dbs.UserID,
+		GroupID:       dbs.GroupID,
+		Mode:          dbs.Mode,
+		DigestEventID: dbs.DigestEventID,
+		DigestSentAt:  dbs.DigestSentAt,
+	}
+}
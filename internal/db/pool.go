@@ -0,0 +1,245 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+)
+
+type dbWishPool struct {
+	WishID       int64          `db:"wish_id"`
+	CreatedBy    sql.NullInt64  `db:"created_by"`
+	TargetAmount int64          `db:"target_amount"`
+	Currency     string         `db:"currency"`
+	ReachedAt    sql.NullString `db:"reached_at"`
+	CreatedAt    string         `db:"created_at"`
+	UpdatedAt    string         `db:"updated_at"`
+}
+
+type WishPool struct {
+	WishID int64
+	// CreatedBy is 0 if the user who started the pool no longer exists.
+	CreatedBy int64
+	Target    money.Amount
+	// ReachedAt is empty until the pledged total reaches the target.
+	ReachedAt string
+	CreatedAt string
+	UpdatedAt string
+}
+
+type dbContribution struct {
+	ContributionID int64  `db:"contribution_id"`
+	WishID         int64  `db:"wish_id"`
+	UserID         int64  `db:"user_id"`
+	Amount         int64  `db:"amount"`
+	Currency       string `db:"currency"`
+	CreatedAt      string `db:"created_at"`
+	UpdatedAt      string `db:"updated_at"`
+}
+
+type Contribution struct {
+	ContributionID int64
+	WishID         int64
+	UserID         int64
+	Amount         money.Amount
+	CreatedAt      string
+	UpdatedAt      string
+}
+
+// GetWishPool returns the pool of a wish.
+// Returns sql.ErrNoRows if nobody started pooling for the wish.
+func GetWishPool(wishID int64) (*WishPool, error) {
+	logger.Sugared.Infow("getting wish pool", "wish_id", wishID)
+
+	var dbPool dbWishPool
+
+	query := "SELECT * FROM wish_pools WHERE wish_id = ?"
+	if err := Database.Get(&dbPool, query, wishID); err != nil {
+		return nil, err
+	}
+
+	return dbPool.toWishPool(), nil
+}
+
+// CreateWishPool starts pooling for a wish with the given target price.
+func CreateWishPool(wishID int64, createdBy int64, target *money.Amount) (*WishPool, error) {
+	logger.Sugared.Infow("creating wish pool", "wish_id", wishID, "created_by", createdBy, "target", target.String())
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery := "INSERT INTO wish_pools (wish_id, created_by, target_amount, currency) VALUES (?, ?, ?, ?)"
+	if _, err := tx.Exec(insertQuery, wishID, createdBy, target.Value, target.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	dbp := &dbWishPool{}
+	selectQuery := "SELECT * FROM wish_pools WHERE wish_id = ?"
+	if err := tx.Get(dbp, selectQuery, wishID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbp.toWishPool(), nil
+}
+
+// MarkWishPoolReached marks a pool as reached.
+// Returns true if the pool was not marked before, so callers can notify pledgers exactly once.
+func MarkWishPoolReached(wishID int64) (bool, error) {
+	logger.Sugared.Infow("marking wish pool as reached", "wish_id", wishID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	updateQuery := "UPDATE wish_pools SET reached_at = datetime('now'), updated_at = datetime('now') WHERE wish_id = ? AND reached_at IS NULL"
+	result, err := tx.Exec(updateQuery, wishID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// GetWishContributions retrieves all pledges made towards a wish pool.
+func GetWishContributions(wishID int64) ([]*Contribution, error) {
+	logger.Sugared.Infow("getting wish contributions", "wish_id", wishID)
+
+	var dbContributions []dbContribution
+
+	query := "SELECT * FROM wish_contributions WHERE wish_id = ? ORDER BY created_at, contribution_id"
+	if err := Database.Select(&dbContributions, query, wishID); err != nil {
+		return nil, err
+	}
+
+	contributions := make([]*Contribution, len(dbContributions))
+	for i, dbc := range dbContributions {
+		contributions[i] = dbc.toContribution()
+	}
+
+	return contributions, nil
+}
+
+// GetUserContributions retrieves all pledges a user made.
+func GetUserContributions(userID int64) ([]*Contribution, error) {
+	logger.Sugared.Infow("getting user contributions", "user_id", userID)
+
+	var dbContributions []dbContribution
+
+	query := "SELECT * FROM wish_contributions WHERE user_id = ? ORDER BY created_at, contribution_id"
+	if err := Database.Select(&dbContributions, query, userID); err != nil {
+		return nil, err
+	}
+
+	contributions := make([]*Contribution, len(dbContributions))
+	for i, dbc := range dbContributions {
+		contributions[i] = dbc.toContribution()
+	}
+
+	return contributions, nil
+}
+
+// SetContribution creates or replaces the pledge of a user towards a wish pool.
+func SetContribution(wishID int64, userID int64, amount *money.Amount) error {
+	logger.Sugared.Infow("setting contribution", "wish_id", wishID, "user_id", userID, "amount", amount.String())
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	upsertQuery := `
+		INSERT INTO wish_contributions (wish_id, user_id, amount, currency) VALUES (?, ?, ?, ?)
+		ON CONFLICT (wish_id, user_id) DO UPDATE SET
+			amount = excluded.amount,
+			currency = excluded.currency,
+			updated_at = datetime('now')
+	`
+	if _, err := tx.Exec(upsertQuery, wishID, userID, amount.Value, amount.Currency); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteContribution withdraws the pledge of a user towards a wish pool.
+func DeleteContribution(wishID int64, userID int64) error {
+	logger.Sugared.Infow("deleting contribution", "wish_id", wishID, "user_id", userID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := "DELETE FROM wish_contributions WHERE wish_id = ? AND user_id = ?"
+	if _, err := tx.Exec(deleteQuery, wishID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PoolTotal sums the pledges made in the pool currency.
+// Pledges in other currencies are never accepted, but are skipped defensively.
+func PoolTotal(pool *WishPool, contributions []*Contribution) money.Amount {
+	total := money.Amount{Currency: pool.Target.Currency}
+	for _, c := range contributions {
+		if c.Amount.Currency != total.Currency {
+			continue
+		}
+		total.Value += c.Amount.Value
+	}
+	return total
+}
+
+func (dbp *dbWishPool) toWishPool() *WishPool {
+	return &WishPool{
+		WishID:    dbp.WishID,
+		CreatedBy: dbp.CreatedBy.Int64,
+		Target:    money.Amount{Value: dbp.TargetAmount, Currency: dbp.Currency},
+		ReachedAt: dbp.ReachedAt.String,
+		CreatedAt: dbp.CreatedAt,
+		UpdatedAt: dbp.UpdatedAt,
+	}
+}
+
+func (dbc *dbContribution) toContribution() *Contribution {
+	return &Contribution{
+		ContributionID: dbc.ContributionID,
+		WishID:         dbc.WishID,
+		UserID:         dbc.UserID,
+		Amount:         money.Amount{Value: dbc.Amount, Currency: dbc.Currency},
+		CreatedAt:      dbc.CreatedAt,
+		UpdatedAt:      dbc.UpdatedAt,
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+)
+
+type dbWishPrice struct {
+	PriceID   int64  `db:"price_id"`
+	WishID    int64  `db:"wish_id"`
+	Amount    int64  `db:"amount"`
+	Currency  string `db:"currency"`
+	CreatedAt string `db:"created_at"`
+	CheckedAt string `db:"checked_at"`
+}
+
+type WishPrice struct {
+	PriceID int64
+	WishID  int64
+	Amount  money.Amount
+	// CreatedAt is when the price was first seen.
+	CreatedAt string
+	// CheckedAt is when the price was last confirmed.
+	CheckedAt string
+}
+
+// GetLatestWishPrice returns the current price of a wish.
+// Returns sql.ErrNoRows if no price was found for the wish yet.
+func GetLatestWishPrice(wishID int64) (*WishPrice, error) {
+	logger.Sugared.Infow("getting latest wish price", "wish_id", wishID)
+
+	var dbPrice dbWishPrice
+
+	query := "SELECT * FROM wish_prices WHERE wish_id = ? ORDER BY price_id DESC LIMIT 1"
+	if err := Database.Get(&dbPrice, query, wishID); err != nil {
+		return nil, err
+	}
+
+	return dbPrice.toWishPrice(), nil
+}
+
+// GetWishPrices retrieves the price history of a wish, oldest first.
+func GetWishPrices(wishID int64) ([]*WishPrice, error) {
+	logger.Sugared.Infow("getting wish prices", "wish_id", wishID)
+
+	var dbPrices []dbWishPrice
+
+	query := "SELECT * FROM wish_prices WHERE wish_id = ? ORDER BY price_id"
+	if err := Database.Select(&dbPrices, query, wishID); err != nil {
+		return nil, err
+	}
+
+	prices := make([]*WishPrice, len(dbPrices))
+	for idx, dbp := range dbPrices {
+		prices[idx] = dbp.toWishPrice()
+	}
+
+	return prices, nil
+}
+
+// RecordWishPrice stores a freshly checked price of a wish.
+// A new history entry is only added if the price differs from the latest one.
+// Returns the previous price, nil if there was none.
+func RecordWishPrice(wishID int64, amount *money.Amount) (*WishPrice, error) {
+	logger.Sugared.Infow("recording wish price", "wish_id", wishID, "amount", amount.String())
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *WishPrice
+	var dbPrevious dbWishPrice
+	selectQuery := "SELECT * FROM wish_prices WHERE wish_id = ? ORDER BY price_id DESC LIMIT 1"
+	err = tx.Get(&dbPrevious, selectQuery, wishID)
+	switch err {
+	case nil:
+		previous = dbPrevious.toWishPrice()
+	case sql.ErrNoRows:
+	default:
+		tx.Rollback()
+		return nil, err
+	}
+
+	if previous != nil && previous.Amount == *amount {
+		updateQuery := "UPDATE wish_prices SET checked_at = datetime('now') WHERE price_id = ?"
+		if _, err := tx.Exec(updateQuery, previous.PriceID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else {
+		insertQuery := "INSERT INTO wish_prices (wish_id, amount, currency) VALUES (?, ?, ?)"
+		if _, err := tx.Exec(insertQuery, wishID, amount.Value, amount.Currency); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+func (dbp *dbWishPrice) toWishPrice() *WishPrice {
+	return &WishPrice{
+		PriceID:   dbp.PriceID,
+		WishID:    dbp.WishID,
+		Amount:    money.Amount{Value: dbp.Amount, Currency: dbp.Currency},
+		CreatedAt: dbp.CreatedAt,
+		CheckedAt: dbp.CheckedAt,
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+// Profile fields, named after their columns.
+const (
+	PROFILE_CLOTHING_SIZE   = "clothing_size"
+	PROFILE_SHOE_SIZE       = "shoe_size"
+	PROFILE_RING_SIZE       = "ring_size"
+	PROFILE_FAVORITE_COLORS = "favorite_colors"
+	PROFILE_ALLERGIES       = "allergies"
+	PROFILE_DISLIKES        = "dislikes"
+)
+
+// ProfileFields lists the profile fields in the order they are asked for and shown.
+var ProfileFields = []string{
+	PROFILE_CLOTHING_SIZE,
+	PROFILE_SHOE_SIZE,
+	PROFILE_RING_SIZE,
+	PROFILE_FAVORITE_COLORS,
+	PROFILE_ALLERGIES,
+	PROFILE_DISLIKES,
+}
+
+type dbProfile struct {
+	UserID         int64  `db:"user_id"`
+	ClothingSize   string `db:"clothing_size"`
+	ShoeSize       string `db:"shoe_size"`
+	RingSize       string `db:"ring_size"`
+	FavoriteColors string `db:"favorite_colors"`
+	Allergies      string `db:"allergies"`
+	Dislikes       string `db:"dislikes"`
+	UpdatedAt      string `db:"updated_at"`
+}
+
+type Profile struct {
+	UserID         int64
+	ClothingSize   string
+	ShoeSize       string
+	RingSize       string
+	FavoriteColors string
+	Allergies      string
+	// Dislikes are the things the user would rather not get.
+	Dislikes  string
+	UpdatedAt string
+}
+
+// Field returns the value of a profile field, empty if it is not set.
+func (p *Profile) Field(field string) string {
+	switch field {
+	case PROFILE_CLOTHING_SIZE:
+		return p.ClothingSize
+	case PROFILE_SHOE_SIZE:
+		return p.ShoeSize
+	case PROFILE_RING_SIZE:
+		return p.RingSize
+	case PROFILE_FAVORITE_COLORS:
+		return p.FavoriteColors
+	case PROFILE_ALLERGIES:
+		return p.Allergies
+	case PROFILE_DISLIKES:
+		return p.Dislikes
+	default:
+		return ""
+	}
+}
+
+// IsEmpty returns true if none of the profile fields are set.
+func (p *Profile) IsEmpty() bool {
+	for _, field := range ProfileFields {
+		if p.Field(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// GetProfile returns the profile of a user.
+// Users who never filled their profile get an empty one.
+func GetProfile(userID int64) (*Profile, error) {
+	logger.Sugared.Infow("getting profile", "user_id", userID)
+
+	var dbProfile dbProfile
+
+	query := "SELECT * FROM profiles WHERE user_id = ?"
+	err := Database.Get(&dbProfile, query, userID)
+	if err == sql.ErrNoRows {
+		return &Profile{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return dbProfile.toProfile(), nil
+}
+
+// SetProfileField changes a single field of the profile of a user. An empty value clears the field.
+func SetProfileField(userID int64, field string, value string) (*Profile, error) {
+	logger.Sugared.Infow("setting profile field", "user_id", userID, "field", field)
+
+	// the field is a column name, it must never come from user input
+	if !slices.Contains(ProfileFields, field) {
+		return nil, fmt.Errorf("unknown profile field: %s", field)
+	}
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	upsertQuery := fmt.Sprintf(`
+	INSERT INTO profiles (user_id, %[1]s) VALUES (?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET
+		%[1]s = excluded.%[1]s,
+		updated_at = datetime('now')
+	`, field)
+	if _, err := tx.Exec(upsertQuery, userID, value); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var dbProfile dbProfile
+	selectQuery := "SELECT * FROM profiles WHERE user_id = ?"
+	if err := tx.Get(&dbProfile, selectQuery, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbProfile.toProfile(), nil
+}
+
+func (dbp *dbProfile) toProfile() *Profile {
+	return &Profile{
+		UserID:         dbp.UserID,
+		ClothingSize:   dbp.ClothingSize,
+		ShoeSize:       dbp.ShoeSize,
+		RingSize:       dbp.RingSize,
+		FavoriteColors: dbp.FavoriteColors,
+		Allergies:      dbp.Allergies,
+		Dislikes:       dbp.Dislikes,
+		UpdatedAt:      dbp.UpdatedAt,
+	}
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+// ftsSchema indexes wishes for full-text search.
+// The index only stores tokens, wish data is read from the wishes table.
+// FTS5 is only available with the sqlite_fts5 build tag, so this is not part of the base schema.
+var ftsSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS wishes_fts USING fts5(
+	url,
+	description,
+	content = 'wishes',
+	content_rowid = 'wish_id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS wishes_fts_insert AFTER INSERT ON wishes BEGIN
+	INSERT INTO wishes_fts (rowid, url, description) VALUES (new.wish_id, new.url, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS wishes_fts_delete AFTER DELETE ON wishes BEGIN
+	INSERT INTO wishes_fts (wishes_fts, rowid, url, description) VALUES ('delete', old.wish_id, old.url, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS wishes_fts_update AFTER UPDATE OF url, description ON wishes BEGIN
+	INSERT INTO wishes_fts (wishes_fts, rowid, url, description) VALUES ('delete', old.wish_id, old.url, old.description);
+	INSERT INTO wishes_fts (rowid, url, description) VALUES (new.wish_id, new.url, new.description);
+END;
+`
+
+// ftsTriggers are dropped when running without FTS5, since writing to wishes would fail otherwise.
+var ftsTriggers = []string{"wishes_fts_insert", "wishes_fts_delete", "wishes_fts_update"}
+
+// initSearch sets up the full-text index of wishes.
+// The index is rebuilt on startup, since wishes may have changed while running without FTS5.
+func initSearch() {
+	if !ftsEnabled {
+		for _, trigger := range ftsTriggers {
+			Database.MustExec("DROP TRIGGER IF EXISTS " + trigger)
+		}
+		logger.Sugared.Warnw("full-text search is disabled, build with the sqlite_fts5 tag to enable it")
+		return
+	}
+
+	Database.MustExec(ftsSchema)
+	Database.MustExec("INSERT INTO wishes_fts (wishes_fts) VALUES ('rebuild')")
+
+	logger.Sugared.Infow("full-text search index rebuilt")
+}
+
+// SearchWishes searches URLs and descriptions of wishes in all groups the user belongs to.
+// Every word of the query must match the beginning of a word in the wish, an empty query matches every wish.
+// Results are grouped by group and owner, the user's own wishes first within a group,
+// each owner's wishes in their ranked order.
+func SearchWishes(userID int64, query string, limit int) ([]*Wish, error) {
+	logger.Sugared.Infow("searching wishes", "user_id", userID, "query", query, "limit", limit, "fts", ftsEnabled)
+
+	terms := searchTerms(query)
+
+	var dbWishes []*dbWish
+	var err error
+
+	if ftsEnabled && len(terms) > 0 {
+		selectQuery := `
+			SELECT w.*
+			FROM wishes_fts f
+			INNER JOIN wishes w ON w.wish_id = f.rowid
+			INNER JOIN group_members gm ON gm.group_id = w.group_id AND gm.user_id = ?
+			INNER JOIN groups g ON g.group_id = w.group_id
+			WHERE wishes_fts MATCH ?
+			ORDER BY g.name COLLATE NOCASE, w.group_id, w.user_id = ? DESC, w.user_id, w.position, f.rank
+			LIMIT ?
+		`
+		err = Database.Select(&dbWishes, selectQuery, userID, ftsMatchQuery(terms), userID, limit)
+	} else {
+		// without FTS every term has to appear somewhere in the url or the description, no terms match every wish
+		where := []string{"1"}
+		args := []any{userID}
+		for _, term := range terms {
+			where = append(where, `(w.url LIKE ? ESCAPE '\' OR w.description LIKE ? ESCAPE '\')`)
+			pattern := likePattern(term)
+			args = append(args, pattern, pattern)
+		}
+		args = append(args, userID, limit)
+
+		selectQuery := `
+			SELECT w.*
+			FROM wishes w
+			INNER JOIN group_members gm ON gm.group_id = w.group_id AND gm.user_id = ?
+			INNER JOIN groups g ON g.group_id = w.group_id
+			WHERE ` + strings.Join(where, " AND ") + `
+			ORDER BY g.name COLLATE NOCASE, w.group_id, w.user_id = ? DESC, w.user_id, w.position, w.wish_id
+			LIMIT ?
+		`
+		err = Database.Select(&dbWishes, selectQuery, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wishes := make([]*Wish, len(dbWishes))
+	for idx, dbw := range dbWishes {
+		wishes[idx] = dbw.toWish()
+	}
+
+	return wishes, nil
+}
+
+// searchTerms splits a query into words, dropping punctuation.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ftsMatchQuery builds an FTS5 query matching words starting with every term.
+// Terms are quoted, so user input can't use the FTS5 query syntax.
+func ftsMatchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for idx, term := range terms {
+		quoted[idx] = `"` + term + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,35 @@
+package db
+
+import "github.com/aybolid/wishbot/internal/logger"
+
+// Stats holds totals of the stored data.
+type Stats struct {
+	Users       int `db:"users"`
+	Groups      int `db:"groups"`
+	BoundGroups int `db:"bound_groups"`
+	Members     int `db:"members"`
+	Wishes      int `db:"wishes"`
+	Pools       int `db:"pools"`
+}
+
+// GetStats counts the stored users, groups, wishes and pools.
+func GetStats() (*Stats, error) {
+	logger.Sugared.Infow("getting stats")
+
+	var stats Stats
+
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users) AS users,
+			(SELECT COUNT(*) FROM groups) AS groups,
+			(SELECT COUNT(*) FROM groups WHERE chat_id IS NOT NULL) AS bound_groups,
+			(SELECT COUNT(*) FROM group_members) AS members,
+			(SELECT COUNT(*) FROM wishes) AS wishes,
+			(SELECT COUNT(*) FROM wish_pools) AS pools
+	`
+	if err := Database.Get(&stats, query); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
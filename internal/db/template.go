@@ -0,0 +1,162 @@
+package db
+
+import (
+	"github.com/aybolid/wishbot/internal/logger"
+)
+
+type dbWishTemplate struct {
+	TemplateID int64  `db:"template_id"`
+	UserID     int64  `db:"user_id"`
+	Name       string `db:"name"`
+	Text       string `db:"text"`
+	CreatedAt  string `db:"created_at"`
+	UpdatedAt  string `db:"updated_at"`
+}
+
+type WishTemplate struct {
+	TemplateID int64
+	UserID     int64
+	Name       string
+	Text       string
+	CreatedAt  string
+	UpdatedAt  string
+}
+
+// GetTemplate returns a wish template by template id.
+func GetTemplate(templateID int64) (*WishTemplate, error) {
+	logger.Sugared.Infow("getting template", "template_id", templateID)
+
+	var dbTemplate dbWishTemplate
+
+	query := "SELECT * FROM wish_templates WHERE template_id = ?"
+	if err := Database.Get(&dbTemplate, query, templateID); err != nil {
+		return nil, err
+	}
+
+	return dbTemplate.toWishTemplate(), nil
+}
+
+// GetUserTemplates returns the wish templates of a user, oldest first.
+func GetUserTemplates(userID int64) ([]*WishTemplate, error) {
+	logger.Sugared.Infow("getting user templates", "user_id", userID)
+
+	var dbTemplates []dbWishTemplate
+
+	query := "SELECT * FROM wish_templates WHERE user_id = ? ORDER BY template_id"
+	if err := Database.Select(&dbTemplates, query, userID); err != nil {
+		return nil, err
+	}
+
+	templates := make([]*WishTemplate, len(dbTemplates))
+	for i, dbt := range dbTemplates {
+		templates[i] = dbt.toWishTemplate()
+	}
+
+	return templates, nil
+}
+
+// GetMemberTemplates returns the wish templates a member attached to a group.
+// Attachments are kept when a member leaves, so the templates show up again if they rejoin.
+func GetMemberTemplates(groupID int64, userID int64) ([]*WishTemplate, error) {
+	logger.Sugared.Infow("getting member templates", "group_id", groupID, "user_id", userID)
+
+	var dbTemplates []dbWishTemplate
+
+	query := `
+	SELECT t.* FROM wish_templates t
+	JOIN template_groups tg ON tg.template_id = t.template_id
+	WHERE tg.group_id = ? AND t.user_id = ?
+	ORDER BY t.template_id
+	`
+	if err := Database.Select(&dbTemplates, query, groupID, userID); err != nil {
+		return nil, err
+	}
+
+	templates := make([]*WishTemplate, len(dbTemplates))
+	for i, dbt := range dbTemplates {
+		templates[i] = dbt.toWishTemplate()
+	}
+
+	return templates, nil
+}
+
+// GetTemplateGroupIDs returns the ids of the groups a wish template is attached to.
+func GetTemplateGroupIDs(templateID int64) ([]int64, error) {
+	logger.Sugared.Infow("getting template groups", "template_id", templateID)
+
+	var groupIDs []int64
+
+	query := "SELECT group_id FROM template_groups WHERE template_id = ?"
+	if err := Database.Select(&groupIDs, query, templateID); err != nil {
+		return nil, err
+	}
+
+	return groupIDs, nil
+}
+
+// CreateTemplate stores a new wish template of a user.
+func CreateTemplate(userID int64, name string, text string) (*WishTemplate, error) {
+	logger.Sugared.Infow("creating template", "user_id", userID, "name", name)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery := "INSERT INTO wish_templates (user_id, name, text) VALUES (?, ?, ?)"
+	result, err := tx.Exec(insertQuery, userID, name, text)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	templateID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var dbTemplate dbWishTemplate
+	selectQuery := "SELECT * FROM wish_templates WHERE template_id = ?"
+	if err := tx.Get(&dbTemplate, selectQuery, templateID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbTemplate.toWishTemplate(), nil
+}
+
+// SetTemplateAttached shows or hides a wish template in a group.
+func SetTemplateAttached(templateID int64, groupID int64, attached bool) error {
+	logger.Sugared.Infow("setting template attached", "template_id", templateID, "group_id", groupID, "attached", attached)
+
+	query := "DELETE FROM template_groups WHERE template_id = ? AND group_id = ?"
+	if attached {
+		query = "INSERT OR IGNORE INTO template_groups (template_id, group_id) VALUES (?, ?)"
+	}
+	_, err := Database.Exec(query, templateID, groupID)
+	return err
+}
+
+// DeleteTemplate deletes a wish template, detaching it from all groups.
+func DeleteTemplate(templateID int64) error {
+	logger.Sugared.Infow("deleting template", "template_id", templateID)
+
+	_, err := Database.Exec("DELETE FROM wish_templates WHERE template_id = ?", templateID)
+	return err
+}
+
+func (dbt *dbWishTemplate) toWishTemplate() *WishTemplate {
+	return &WishTemplate{
+		TemplateID: dbt.TemplateID,
+		UserID:     dbt.UserID,
+		Name:       dbt.Name,
+		Text:       dbt.Text,
+		CreatedAt:  dbt.CreatedAt,
+		UpdatedAt:  dbt.UpdatedAt,
+	}
+}
@@ -1,25 +1,107 @@
 package db
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+)
 
 type dbUser struct {
 	UserID int64 `db:"user_id"`
 	// Username is stored without the @ symbol.
-	Username  string `db:"username"`
-	ChatID    int64  `db:"chat_id"`
-	Language  string `db:"language"`
-	CreatedAt string `db:"created_at"`
-	UpdatedAt string `db:"updated_at"`
+	Username  sql.NullString `db:"username"`
+	FirstName string         `db:"first_name"`
+	LastName  sql.NullString `db:"last_name"`
+	ChatID    int64          `db:"chat_id"`
+	Language  string         `db:"language"`
+	CreatedAt string         `db:"created_at"`
+	UpdatedAt string         `db:"updated_at"`
+	Timezone  string         `db:"timezone"`
+	// QuietStart and QuietEnd are minutes since midnight in the timezone of the user.
+	QuietStart int `db:"quiet_start"`
+	QuietEnd   int `db:"quiet_end"`
 }
 
 type User struct {
 	UserID int64
 	// Username is stored without the @ symbol.
+	// Empty if the user has no username.
 	Username  string
+	FirstName string
+	LastName  string
 	ChatID    int64
 	Language  string
 	CreatedAt string
 	UpdatedAt string
+	// Timezone is an IANA time zone name, e.g. "Europe/Kyiv".
+	Timezone string
+	// QuietStart and QuietEnd are minutes since midnight in the timezone of the user.
+	// Quiet hours are off if both are equal.
+	QuietStart int
+	QuietEnd   int
+}
+
+// Location returns the time zone of the user, UTC if the stored zone is unknown.
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// HasQuietHours returns true if the user set quiet hours.
+func (u *User) HasQuietHours() bool {
+	return u.QuietStart != u.QuietEnd
+}
+
+// QuietUntil returns when the quiet hours of the user end, if t falls within them.
+// Quiet hours may wrap around midnight, e.g. from 22:00 to 08:00.
+func (u *User) QuietUntil(t time.Time) (time.Time, bool) {
+	if !u.HasQuietHours() {
+		return time.Time{}, false
+	}
+
+	local := t.In(u.Location())
+	minute := local.Hour()*60 + local.Minute()
+
+	var quiet bool
+	if u.QuietStart < u.QuietEnd {
+		quiet = minute >= u.QuietStart && minute < u.QuietEnd
+	} else {
+		quiet = minute >= u.QuietStart || minute < u.QuietEnd
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	end := time.Date(local.Year(), local.Month(), local.Day(), u.QuietEnd/60, u.QuietEnd%60, 0, 0, local.Location())
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// DisplayName returns the @username of a user, or the full name if the user has no username.
+func (u *User) DisplayName() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		return "?"
+	}
+	return name
+}
+
+// ProfileChanged returns true if the stored username or name differ from the telegram user.
+func (u *User) ProfileChanged(tgUser *tgbotapi.User) bool {
+	return u.Username != tgUser.UserName || u.FirstName != tgUser.FirstName || u.LastName != tgUser.LastName
 }
 
 // GetUser returns a user by user id.
@@ -47,15 +129,69 @@ func GetUserByUsername(username string) (*User, error) {
 	return dbUser.toUser(), nil
 }
 
+// GetAllUsers returns every user.
+func GetAllUsers() ([]*User, error) {
+	logger.Sugared.Infow("getting all users")
+
+	var dbUsers []dbUser
+
+	query := "SELECT * FROM users ORDER BY user_id"
+	if err := Database.Select(&dbUsers, query); err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, len(dbUsers))
+	for i, dbu := range dbUsers {
+		users[i] = dbu.toUser()
+	}
+
+	return users, nil
+}
+
+// FindUsers searches users by user id, username or name.
+// Usernames may be passed with the @ symbol.
+func FindUsers(query string, limit int) ([]*User, error) {
+	logger.Sugared.Infow("finding users", "query", query, "limit", limit)
+
+	var dbUsers []dbUser
+
+	userID, _ := strconv.ParseInt(query, 10, 64)
+	pattern := likePattern(strings.TrimPrefix(query, "@"))
+	selectQuery := `
+		SELECT * FROM users
+		WHERE user_id = ?
+		OR username LIKE ? ESCAPE '\'
+		OR (first_name || ' ' || IFNULL(last_name, '')) LIKE ? ESCAPE '\'
+		ORDER BY user_id = ? DESC, username IS NULL, username
+		LIMIT ?
+	`
+	if err := Database.Select(&dbUsers, selectQuery, userID, pattern, pattern, userID, limit); err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, len(dbUsers))
+	for i, dbu := range dbUsers {
+		users[i] = dbu.toUser()
+	}
+
+	return users, nil
+}
+
 // CreateUser creates a new user in the database.
-func CreateUser(user *tgbotapi.User, chatID int64) (*User, error) {
+// Language is the language the bot speaks to the user.
+func CreateUser(user *tgbotapi.User, chatID int64, language string) (*User, error) {
 	tx, err := Database.Beginx()
 	if err != nil {
 		return nil, err
 	}
 
-	insertQuery := "INSERT INTO users (user_id, username, chat_id) VALUES (?, ?, ?)"
-	if _, err := tx.Exec(insertQuery, user.ID, user.UserName, chatID); err != nil {
+	if err := releaseUsername(tx, user); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	insertQuery := "INSERT INTO users (user_id, username, first_name, last_name, chat_id, language) VALUES (?, ?, ?, ?, ?, ?)"
+	if _, err := tx.Exec(insertQuery, user.ID, nullString(user.UserName), user.FirstName, nullString(user.LastName), chatID, language); err != nil {
 		tx.Rollback()
 		return nil, err
 	}
@@ -74,6 +210,132 @@ func CreateUser(user *tgbotapi.User, chatID int64) (*User, error) {
 	return dbu.toUser(), nil
 }
 
+// UpdateUserProfile stores the current username and name of a telegram user.
+func UpdateUserProfile(user *tgbotapi.User) error {
+	logger.Sugared.Infow("updating user profile", "user_id", user.ID, "username", user.UserName)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := releaseUsername(tx, user); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	updateQuery := "UPDATE users SET username = ?, first_name = ?, last_name = ?, updated_at = datetime('now') WHERE user_id = ?"
+	if _, err := tx.Exec(updateQuery, nullString(user.UserName), user.FirstName, nullString(user.LastName), user.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// releaseUsername takes the username of a telegram user away from any other stored user.
+// Usernames can be changed and taken over by someone else, so whoever uses a username most recently owns it.
+func releaseUsername(tx *sqlx.Tx, user *tgbotapi.User) error {
+	if user.UserName == "" {
+		return nil
+	}
+
+	updateQuery := "UPDATE users SET username = NULL, updated_at = datetime('now') WHERE username = ? AND user_id != ?"
+	result, err := tx.Exec(updateQuery, user.UserName, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if released, err := result.RowsAffected(); err == nil && released > 0 {
+		logger.Sugared.Infow("released username taken over by another user", "username", user.UserName, "user_id", user.ID)
+	}
+
+	return nil
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// DeleteUser deletes a user along with their memberships, wishes and pledges.
+// Owned groups with other members are transferred to their successor, see GetGroupSuccessor.
+// Owned groups without other members are deleted.
+// Returns the new owner ids of transferred groups keyed by group id.
+func DeleteUser(userID int64) (map[int64]int64, error) {
+	logger.Sugared.Infow("deleting user", "user_id", userID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	var ownedGroupIDs []int64
+	if err := tx.Select(&ownedGroupIDs, "SELECT group_id FROM groups WHERE owner_id = ?", userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	newOwners := make(map[int64]int64)
+	for _, groupID := range ownedGroupIDs {
+		successor, err := getGroupSuccessor(tx, groupID, userID)
+		if err == sql.ErrNoRows {
+			// deleting the user deletes the groups they own
+			continue
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		updateQuery := "UPDATE groups SET owner_id = ?, updated_at = datetime('now') WHERE group_id = ?"
+		if _, err := tx.Exec(updateQuery, successor.UserID, groupID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := recordEvent(tx, groupID, userID, successor.UserID, AUDIT_OWNERSHIP_TRANSFERRED, ""); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		newOwners[groupID] = successor.UserID
+	}
+
+	var memberGroupIDs []int64
+	if err := tx.Select(&memberGroupIDs, "SELECT group_id FROM group_members WHERE user_id = ?", userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, groupID := range memberGroupIDs {
+		if err := recordEvent(tx, groupID, userID, 0, AUDIT_MEMBER_LEFT, ""); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// the details of wish events hold the links of the user, only the fact that something happened is kept
+	blankQuery := "UPDATE audit_events SET details = '' WHERE actor_id = ? OR subject_id = ?"
+	if _, err := tx.Exec(blankQuery, userID, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// memberships, wishes, pledges and remaining owned groups are deleted by cascade
+	if _, err := tx.Exec("DELETE FROM users WHERE user_id = ?", userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return newOwners, nil
+}
+
 func UpdateLanguage(userID int64, language string) error {
 	tx, err := Database.Beginx()
 	if err != nil {
@@ -93,13 +355,37 @@ func UpdateLanguage(userID int64, language string) error {
 	return nil
 }
 
+// UpdateTimezone stores the IANA time zone name of a user.
+func UpdateTimezone(userID int64, timezone string) error {
+	logger.Sugared.Infow("updating timezone", "user_id", userID, "timezone", timezone)
+
+	updateQuery := "UPDATE users SET timezone = ?, updated_at = datetime('now') WHERE user_id = ?"
+	_, err := Database.Exec(updateQuery, timezone, userID)
+	return err
+}
+
+// UpdateQuietHours stores the quiet hours of a user, in minutes since midnight.
+// Pass equal values to turn quiet hours off.
+func UpdateQuietHours(userID int64, start int, end int) error {
+	logger.Sugared.Infow("updating quiet hours", "user_id", userID, "start", start, "end", end)
+
+	updateQuery := "UPDATE users SET quiet_start = ?, quiet_end = ?, updated_at = datetime('now') WHERE user_id = ?"
+	_, err := Database.Exec(updateQuery, start, end, userID)
+	return err
+}
+
 func (dbu *dbUser) toUser() *User {
 	return &User{
-		UserID:    dbu.UserID,
-		Username:  dbu.Username,
-		ChatID:    dbu.ChatID,
-		Language:  dbu.Language,
-		CreatedAt: dbu.CreatedAt,
-		UpdatedAt: dbu.UpdatedAt,
+		UserID:     dbu.UserID,
+		Username:   dbu.Username.String,
+		FirstName:  dbu.FirstName,
+		LastName:   dbu.LastName.String,
+		ChatID:     dbu.ChatID,
+		Language:   dbu.Language,
+		CreatedAt:  dbu.CreatedAt,
+		UpdatedAt:  dbu.UpdatedAt,
+		Timezone:   dbu.Timezone,
+		QuietStart: dbu.QuietStart,
+		QuietEnd:   dbu.QuietEnd,
 	}
 }
@@ -1,6 +1,11 @@
 package db
 
-import "github.com/aybolid/wishbot/internal/logger"
+import (
+	"slices"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/logger"
+)
 
 type dbWish struct {
 	WishID      int64  `db:"wish_id"`
@@ -9,6 +14,7 @@ type dbWish struct {
 	MemberID    int64  `db:"member_id"`
 	URL         string `db:"url"`
 	Description string `db:"description"`
+	Position    int    `db:"position"`
 	CreatedAt   string `db:"created_at"`
 	UpdatedAt   string `db:"updated_at"`
 }
@@ -20,8 +26,10 @@ type Wish struct {
 	MemberID    int64
 	URL         string
 	Description string
-	CreatedAt   string
-	UpdatedAt   string
+	// Position ranks the wish within the owner's list in the group, the most important first.
+	Position  int
+	CreatedAt string
+	UpdatedAt string
 }
 
 // GetWish returns a wish by wish id.
@@ -39,14 +47,31 @@ func GetWish(wishID int64) (*Wish, error) {
 }
 
 // DeleteWish deletes a wish by wish id.
-func DeleteWish(wishID int64) error {
-	logger.Sugared.Infow("deleting wish", "wish_id", wishID)
+// The actor is the user deleting the wish.
+func DeleteWish(wishID int64, actorID int64) error {
+	logger.Sugared.Infow("deleting wish", "wish_id", wishID, "actor_id", actorID)
 
 	tx, err := Database.Beginx()
 	if err != nil {
 		return err
 	}
 
+	dbw := &dbWish{}
+	selectQuery := "SELECT * FROM wishes WHERE wish_id = ?"
+	if err := tx.Get(dbw, selectQuery, wishID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	subjectID := dbw.UserID
+	if subjectID == actorID {
+		subjectID = 0
+	}
+	if err := recordEvent(tx, dbw.GroupID, actorID, subjectID, AUDIT_WISH_DELETED, dbw.URL); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	deleteQuery := "DELETE FROM wishes WHERE wish_id = ?"
 	if _, err := tx.Exec(deleteQuery, wishID); err != nil {
 		tx.Rollback()
@@ -60,13 +85,63 @@ func DeleteWish(wishID int64) error {
 	return nil
 }
 
-// GetUserWishes retrieves all wishes for a given user and group.
+// UpdateWishURL replaces the url of a wish, e.g. when the old link stopped working.
+// The price history and link status belong to the old page, so they are dropped.
+// The actor is the user updating the wish.
+func UpdateWishURL(wishID int64, url string, actorID int64) (*Wish, error) {
+	logger.Sugared.Infow("updating wish url", "wish_id", wishID, "url", url, "actor_id", actorID)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	updateQuery := "UPDATE wishes SET url = ?, updated_at = datetime('now') WHERE wish_id = ?"
+	if _, err := tx.Exec(updateQuery, url, wishID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, deleteQuery := range []string{
+		"DELETE FROM wish_prices WHERE wish_id = ?",
+		"DELETE FROM wish_links WHERE wish_id = ?",
+	} {
+		if _, err := tx.Exec(deleteQuery, wishID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	dbw := &dbWish{}
+	selectQuery := "SELECT * FROM wishes WHERE wish_id = ?"
+	if err := tx.Get(dbw, selectQuery, wishID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	subjectID := dbw.UserID
+	if subjectID == actorID {
+		subjectID = 0
+	}
+	if err := recordEvent(tx, dbw.GroupID, actorID, subjectID, AUDIT_WISH_UPDATED, url); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return dbw.toWish(), nil
+}
+
+// GetUserWishes retrieves all wishes for a given user and group, ordered by position.
 func GetUserWishes(userID int64, groupID int64) ([]*Wish, error) {
 	logger.Sugared.Infow("getting user wishes", "user_id", userID, "group_id", groupID)
 
 	var dbWishes []*dbWish
 
-	selectQuery := "SELECT * FROM wishes WHERE user_id = ? AND group_id = ?"
+	selectQuery := "SELECT * FROM wishes WHERE user_id = ? AND group_id = ? ORDER BY position, wish_id"
 	err := Database.Select(&dbWishes, selectQuery, userID, groupID)
 	if err != nil {
 		return nil, err
@@ -81,12 +156,13 @@ func GetUserWishes(userID int64, groupID int64) ([]*Wish, error) {
 }
 
 // GetGroupWishes retrieves all wishes for a given group.
+// Wishes are ordered by their owner and then by position.
 func GetGroupWishes(groupID int64) ([]*Wish, error) {
 	logger.Sugared.Infow("getting group wishes", "group_id", groupID)
 
 	var dbWishes []*dbWish
 
-	selectQuery := "SELECT * FROM wishes WHERE group_id = ?"
+	selectQuery := "SELECT * FROM wishes WHERE group_id = ? ORDER BY user_id, position, wish_id"
 	err := Database.Select(&dbWishes, selectQuery, groupID)
 	if err != nil {
 		return nil, err
@@ -100,6 +176,26 @@ func GetGroupWishes(groupID int64) ([]*Wish, error) {
 	return wishes, nil
 }
 
+// GetAllWishes retrieves the wishes of all groups, oldest first.
+func GetAllWishes() ([]*Wish, error) {
+	logger.Sugared.Infow("getting all wishes")
+
+	var dbWishes []*dbWish
+
+	selectQuery := "SELECT * FROM wishes ORDER BY created_at, wish_id"
+	err := Database.Select(&dbWishes, selectQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	wishes := make([]*Wish, len(dbWishes))
+	for idx, dbw := range dbWishes {
+		wishes[idx] = dbw.toWish()
+	}
+
+	return wishes, nil
+}
+
 // CreateWish creates a new wish for a given user and group.
 func CreateWish(url string, desc string, userID int64, groupID int64) (*Wish, error) {
 	logger.Sugared.Infow("creating wish", "url", url, "description", desc, "user_id", userID, "group_id", groupID)
@@ -114,8 +210,12 @@ func CreateWish(url string, desc string, userID int64, groupID int64) (*Wish, er
 		return nil, err
 	}
 
-	insertQuery := "INSERT INTO wishes (url, description, user_id, group_id, member_id) VALUES (?, ?, ?, ?, ?)"
-	result, err := tx.Exec(insertQuery, url, desc, userID, groupID, member.MemberID)
+	// new wishes go to the bottom of the list
+	insertQuery := `
+	INSERT INTO wishes (url, description, user_id, group_id, member_id, position)
+	VALUES (?, ?, ?, ?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM wishes WHERE user_id = ? AND group_id = ?))
+	`
+	result, err := tx.Exec(insertQuery, url, desc, userID, groupID, member.MemberID, userID, groupID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -127,6 +227,11 @@ func CreateWish(url string, desc string, userID int64, groupID int64) (*Wish, er
 		return nil, err
 	}
 
+	if err := recordEvent(tx, groupID, userID, 0, AUDIT_WISH_CREATED, url); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	dbw := &dbWish{}
 	selectQuery := "SELECT * FROM wishes WHERE wish_id = ?"
 	if err := tx.Get(dbw, selectQuery, wishID); err != nil {
@@ -141,6 +246,59 @@ func CreateWish(url string, desc string, userID int64, groupID int64) (*Wish, er
 	return dbw.toWish(), nil
 }
 
+// MoveWish moves a wish within the owner's list in the group by offset positions,
+// e.g. -1 moves it up by one. Offsets past the ends of the list are clamped,
+// so a large negative offset moves the wish to the top.
+// Returns the new position of the wish.
+func MoveWish(wishID int64, offset int) (int, error) {
+	logger.Sugared.Infow("moving wish", "wish_id", wishID, "offset", offset)
+
+	tx, err := Database.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	dbw := &dbWish{}
+	selectQuery := "SELECT * FROM wishes WHERE wish_id = ?"
+	if err := tx.Get(dbw, selectQuery, wishID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var ids []int64
+	listQuery := "SELECT wish_id FROM wishes WHERE user_id = ? AND group_id = ? ORDER BY position, wish_id"
+	if err := tx.Select(&ids, listQuery, dbw.UserID, dbw.GroupID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	from := slices.Index(ids, wishID)
+	to := min(max(from+offset, 0), len(ids)-1)
+	ids = slices.Insert(slices.Delete(ids, from, from+1), to, wishID)
+
+	// the whole list is renumbered, so gaps left by deleted wishes are closed
+	updateQuery := "UPDATE wishes SET position = ? WHERE wish_id = ?"
+	for position, id := range ids {
+		if _, err := tx.Exec(updateQuery, position, id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return to, nil
+}
+
+// likePattern returns a case insensitive LIKE pattern matching the query anywhere in a value.
+// LIKE wildcards in the query are escaped with a backslash.
+func likePattern(query string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + replacer.Replace(strings.TrimSpace(query)) + "%"
+}
+
 func (dbw *dbWish) toWish() *Wish {
 	return &Wish{
 		WishID:      dbw.WishID,
@@ -149,6 +307,7 @@ func (dbw *dbWish) toWish() *Wish {
 		MemberID:    dbw.MemberID,
 		URL:         dbw.URL,
 		Description: dbw.Description,
+		Position:    dbw.Position,
 		CreatedAt:   dbw.CreatedAt,
 		UpdatedAt:   dbw.UpdatedAt,
 	}
@@ -3,11 +3,29 @@ package env
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	MODE_ENV    = "MODE"
-	BOT_API_KEY = "BOT_API_KEY"
+	MODE_ENV       = "MODE"
+	BOT_API_KEY    = "BOT_API_KEY"
+	ADMIN_USER_IDS = "ADMIN_USER_IDS"
+
+	PRICE_CHECK_INTERVAL = "PRICE_CHECK_INTERVAL"
+	PRICE_DROP_PERCENT   = "PRICE_DROP_PERCENT"
+	LINK_CHECK_INTERVAL  = "LINK_CHECK_INTERVAL"
+	URL_TRACKING_PARAMS  = "URL_TRACKING_PARAMS"
+	DIGEST_HOUR          = "DIGEST_HOUR"
+)
+
+const (
+	DEFAULT_PRICE_CHECK_INTERVAL = 6 * time.Hour
+	DEFAULT_PRICE_DROP_PERCENT   = 10
+	DEFAULT_LINK_CHECK_INTERVAL  = 24 * time.Hour
+	DEFAULT_DIGEST_HOUR          = 18
 )
 
 const (
@@ -21,6 +39,19 @@ type vars struct {
 	Mode string
 	// Telegram bot API key.
 	BotAPIKey string
+	// Telegram user ids of the bot operators, comma separated in the environment.
+	AdminUserIDs []int64
+	// How often the prices of wishes are checked. Zero disables price tracking.
+	PriceCheckInterval time.Duration
+	// Members are notified when the price of a wish drops by at least this many percent.
+	PriceDropPercent int
+	// How often wish links are checked for dead or out of stock pages. Zero disables link checking.
+	LinkCheckInterval time.Duration
+	// Extra query parameters stripped from wish urls, comma separated in the environment.
+	// A trailing "*" matches any suffix.
+	URLTrackingParams []string
+	// Hour of the day (0-23) at which wish digests are sent, in the time zone of each user.
+	DigestHour int
 }
 
 // Vars is the environment variables.
@@ -44,4 +75,82 @@ func Init() {
 	if Vars.BotAPIKey == "" {
 		panic(fmt.Errorf("missing %s environment variable", BOT_API_KEY))
 	}
+
+	adminUserIDs, err := parseIDs(os.Getenv(ADMIN_USER_IDS))
+	if err != nil {
+		panic(fmt.Errorf("invalid %s environment variable: %w", ADMIN_USER_IDS, err))
+	}
+	Vars.AdminUserIDs = adminUserIDs
+
+	Vars.PriceCheckInterval = DEFAULT_PRICE_CHECK_INTERVAL
+	if value := os.Getenv(PRICE_CHECK_INTERVAL); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			panic(fmt.Errorf("invalid %s environment variable: %q", PRICE_CHECK_INTERVAL, value))
+		}
+		Vars.PriceCheckInterval = interval
+	}
+
+	Vars.PriceDropPercent = DEFAULT_PRICE_DROP_PERCENT
+	if value := os.Getenv(PRICE_DROP_PERCENT); value != "" {
+		percent, err := strconv.Atoi(value)
+		if err != nil || percent < 1 || percent > 100 {
+			panic(fmt.Errorf("invalid %s environment variable: %q", PRICE_DROP_PERCENT, value))
+		}
+		Vars.PriceDropPercent = percent
+	}
+
+	Vars.LinkCheckInterval = DEFAULT_LINK_CHECK_INTERVAL
+	if value := os.Getenv(LINK_CHECK_INTERVAL); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			panic(fmt.Errorf("invalid %s environment variable: %q", LINK_CHECK_INTERVAL, value))
+		}
+		Vars.LinkCheckInterval = interval
+	}
+
+	Vars.URLTrackingParams = parseList(os.Getenv(URL_TRACKING_PARAMS))
+
+	Vars.DigestHour = DEFAULT_DIGEST_HOUR
+	if value := os.Getenv(DIGEST_HOUR); value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil || hour < 0 || hour > 23 {
+			panic(fmt.Errorf("invalid %s environment variable: %q", DIGEST_HOUR, value))
+		}
+		Vars.DigestHour = hour
+	}
+}
+
+// IsAdmin returns true if a user is one of the bot operators.
+func (v *vars) IsAdmin(userID int64) bool {
+	return slices.Contains(v.AdminUserIDs, userID)
+}
+
+// parseIDs parses a comma separated list of ids. Empty entries are ignored.
+func parseIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseList parses a comma separated list. Empty entries are ignored.
+func parseList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
 }
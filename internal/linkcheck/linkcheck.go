@@ -0,0 +1,102 @@
+// Package linkcheck finds wish links that stopped working.
+package linkcheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/aybolid/wishbot/internal/price"
+)
+
+// Link statuses.
+const (
+	STATUS_OK = "ok"
+	// STATUS_DEAD is a page that is gone for good (404 or 410).
+	STATUS_DEAD = "dead"
+	// STATUS_OUT_OF_STOCK is a product page saying the product is not available.
+	STATUS_OUT_OF_STOCK = "out_of_stock"
+	// STATUS_UNREACHABLE is a page that could not be checked, e.g. a timeout or a server error.
+	// These are often temporary, so they are not reported to the owner.
+	STATUS_UNREACHABLE = "unreachable"
+)
+
+// Result is the outcome of checking a link.
+type Result struct {
+	Status string
+	// StatusCode is the http status of the page, 0 if it could not be reached.
+	StatusCode int
+	// FinalURL is the url after following redirects.
+	FinalURL string
+}
+
+// Broken reports whether the owner of the link should fix it.
+func (r Result) Broken() bool {
+	return r.Status == STATUS_DEAD || r.Status == STATUS_OUT_OF_STOCK
+}
+
+// Checker checks links over HTTP.
+type Checker struct {
+	client      *http.Client
+	maxPageSize int64
+}
+
+// NewChecker creates a checker using the given client, see price.NewHTTPClient.
+func NewChecker(client *http.Client) *Checker {
+	return &Checker{
+		client:      client,
+		maxPageSize: price.DEFAULT_MAX_PAGE_SIZE,
+	}
+}
+
+// Check checks a link, following redirects.
+// The page is downloaded with a GET request, which also tells whether the product is out of stock.
+// HEAD requests are not used, some servers answer them with a 404 for pages that exist.
+func (c *Checker) Check(ctx context.Context, pageURL string) Result {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return Result{Status: STATUS_UNREACHABLE, FinalURL: pageURL}
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, pageURL)
+	if err != nil {
+		return Result{Status: STATUS_UNREACHABLE, FinalURL: pageURL}
+	}
+	defer resp.Body.Close()
+
+	result := Result{StatusCode: resp.StatusCode, FinalURL: resp.Request.URL.String()}
+	switch {
+	case isGone(resp.StatusCode):
+		result.Status = STATUS_DEAD
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		result.Status = STATUS_UNREACHABLE
+	default:
+		page, err := io.ReadAll(io.LimitReader(resp.Body, c.maxPageSize))
+		switch {
+		case err != nil:
+			result.Status = STATUS_UNREACHABLE
+		case price.OutOfStock(page):
+			result.Status = STATUS_OUT_OF_STOCK
+		default:
+			result.Status = STATUS_OK
+		}
+	}
+
+	return result
+}
+
+func (c *Checker) do(ctx context.Context, method string, pageURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", price.USER_AGENT)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	return c.client.Do(req)
+}
+
+func isGone(statusCode int) bool {
+	return statusCode == http.StatusNotFound || statusCode == http.StatusGone
+}
@@ -1,30 +1,132 @@
 package locals
 
 import (
+	"embed"
+	"errors"
+	"path"
+	"slices"
+
 	"github.com/BurntSushi/toml"
+	"github.com/aybolid/wishbot/internal/logger"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"golang.org/x/text/language"
 )
 
-const (
-	UKRAINIAN = "uk"
-	ENGLISH   = "en"
-)
+// ENGLISH is the default language. Messages missing in other translations fall back to it.
+const ENGLISH = "en"
+
+// Translations are discovered automatically, adding an active.<language>.toml file adds a language.
+//
+//go:embed active.*.toml
+var localsFS embed.FS
 
-const (
-	EN_LOCALS_FILE = "active.en.toml"
-	UK_LOCALS_FILE = "active.uk.toml"
+// Languages lists every supported language, the default language comes first.
+var Languages []string
+
+var (
+	bundle  *i18n.Bundle
+	matcher language.Matcher
 )
 
-var bundle *i18n.Bundle
+// Localizer is an i18n.Localizer that falls back to English for messages missing in a translation.
+type Localizer struct {
+	*i18n.Localizer
+}
 
+// Init loads all embedded translation files.
+// Panics if a translation file is invalid.
 func Init() {
 	bundle = i18n.NewBundle(language.English)
 	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	bundle.MustLoadMessageFile(EN_LOCALS_FILE)
-	bundle.MustLoadMessageFile(UK_LOCALS_FILE)
+
+	files, err := localsFS.ReadDir(".")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		filePath := path.Join(".", file.Name())
+		data, err := localsFS.ReadFile(filePath)
+		if err != nil {
+			panic(err)
+		}
+		bundle.MustParseMessageFileBytes(data, filePath)
+	}
+
+	// the bundle lists the default language first
+	tags := bundle.LanguageTags()
+	Languages = make([]string, len(tags))
+	for i, tag := range tags {
+		Languages[i] = tag.String()
+	}
+	matcher = language.NewMatcher(tags)
+
+	logger.Sugared.Infow("loaded translations", "languages", Languages)
+
+	checkAgainstDefault()
 }
 
-func GetLocalizer(lang string) *i18n.Localizer {
-	return i18n.NewLocalizer(bundle, lang)
+// checkAgainstDefault logs messages that other translations miss or have in addition to English.
+// Missing messages fall back to English, so they are not fatal.
+func checkAgainstDefault() {
+	ids, err := MessageIDs()
+	if err != nil {
+		logger.Sugared.Errorw("failed to read translation message ids", "err", err)
+		return
+	}
+
+	reports, err := CheckTranslations(ids[ENGLISH])
+	if err != nil {
+		logger.Sugared.Errorw("failed to check translations", "err", err)
+		return
+	}
+
+	for _, report := range reports {
+		if !report.OK() {
+			logger.Sugared.Warnw("incomplete translation", "language", report.Language, "missing", report.Missing, "unused", report.Unused)
+		}
+	}
+}
+
+// GetLocalizer returns a localizer for a language.
+// Unsupported languages get the closest supported one, or English.
+func GetLocalizer(lang string) *Localizer {
+	return &Localizer{Localizer: i18n.NewLocalizer(bundle, lang)}
+}
+
+// MatchLanguage returns the supported language closest to an IETF language tag,
+// such as the language_code of a telegram user. Returns English if nothing matches.
+func MatchLanguage(code string) string {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return ENGLISH
+	}
+
+	_, index, confidence := matcher.Match(tag)
+	if confidence == language.No {
+		return ENGLISH
+	}
+	return Languages[index]
+}
+
+// IsSupported returns true if there is a translation for a language.
+func IsSupported(lang string) bool {
+	return slices.Contains(Languages, lang)
+}
+
+// MustLocalize is like i18n.Localizer.MustLocalize, but messages missing in a translation
+// are taken from English instead of panicking. It still panics if English misses the message too.
+func (l *Localizer) MustLocalize(lc *i18n.LocalizeConfig) string {
+	msg, err := l.Localizer.Localize(lc)
+	if err == nil {
+		return msg
+	}
+
+	var notFound *i18n.MessageNotFoundErr
+	if errors.As(err, &notFound) && msg != "" {
+		logger.Sugared.Warnw("missing translation", "message_id", notFound.MessageID, "language", notFound.Tag.String())
+		return msg
+	}
+
+	panic(err)
 }
@@ -0,0 +1,139 @@
+package locals
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// Report lists the problems of a single translation.
+type Report struct {
+	Language string
+	// Missing message ids are expected but absent in the translation.
+	Missing []string
+	// Unused message ids are present in the translation but never expected.
+	Unused []string
+}
+
+// OK returns true if the translation has no missing or unused messages.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unused) == 0
+}
+
+// MessageIDs returns the sorted message ids of every embedded translation keyed by language.
+func MessageIDs() (map[string][]string, error) {
+	files, err := localsFS.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshalFuncs := map[string]i18n.UnmarshalFunc{"toml": toml.Unmarshal}
+	ids := make(map[string][]string, len(files))
+
+	for _, file := range files {
+		filePath := path.Join(".", file.Name())
+		data, err := localsFS.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		messageFile, err := i18n.ParseMessageFileBytes(data, filePath, unmarshalFuncs)
+		if err != nil {
+			return nil, err
+		}
+
+		lang := messageFile.Tag.String()
+		for _, message := range messageFile.Messages {
+			ids[lang] = append(ids[lang], message.ID)
+		}
+		slices.Sort(ids[lang])
+	}
+
+	return ids, nil
+}
+
+// CheckTranslations compares every embedded translation with the expected message ids.
+// Reports are returned for every language, sorted by language.
+func CheckTranslations(expected []string) ([]*Report, error) {
+	ids, err := MessageIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*Report
+	for lang, actual := range ids {
+		reports = append(reports, &Report{
+			Language: lang,
+			Missing:  difference(expected, actual),
+			Unused:   difference(actual, expected),
+		})
+	}
+	slices.SortFunc(reports, func(a, b *Report) int {
+		return strings.Compare(a.Language, b.Language)
+	})
+
+	return reports, nil
+}
+
+// ReferencedMessageIDs returns the sorted message ids referenced in the go files of a directory.
+// Ids are collected from string literals assigned to fields ending in MessageID, test files are skipped.
+func ReferencedMessageIDs(dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				kv, ok := node.(*ast.KeyValueExpr)
+				if !ok {
+					return true
+				}
+
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok || !strings.HasSuffix(strings.ToLower(key.Name), "messageid") {
+					return true
+				}
+
+				lit, ok := kv.Value.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+
+				id, err := strconv.Unquote(lit.Value)
+				if err == nil && !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+				return true
+			})
+		}
+	}
+
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// difference returns the sorted ids of a that are not in b.
+func difference(a, b []string) []string {
+	var diff []string
+	for _, id := range a {
+		if !slices.Contains(b, id) && !slices.Contains(diff, id) {
+			diff = append(diff, id)
+		}
+	}
+	slices.Sort(diff)
+	return diff
+}
@@ -0,0 +1,27 @@
+package locals
+
+import "testing"
+
+func TestTranslationsCoverReferencedIDs(t *testing.T) {
+	referenced, err := ReferencedMessageIDs("../tgbot")
+	if err != nil {
+		t.Fatalf("failed to collect message ids: %v", err)
+	}
+	if len(referenced) == 0 {
+		t.Fatal("no message ids referenced in ../tgbot")
+	}
+
+	reports, err := CheckTranslations(referenced)
+	if err != nil {
+		t.Fatalf("failed to check translations: %v", err)
+	}
+
+	for _, report := range reports {
+		for _, id := range report.Missing {
+			t.Errorf("%s: missing %s", report.Language, id)
+		}
+		for _, id := range report.Unused {
+			t.Errorf("%s: unused %s", report.Language, id)
+		}
+	}
+}
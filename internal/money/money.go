@@ -0,0 +1,213 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Amount is a monetary amount stored in minor units (e.g. cents) along with its currency code.
+type Amount struct {
+	// Value in minor units. 1500 UAH is stored as 150000.
+	Value int64
+	// ISO 4217 currency code, upper case.
+	Currency string
+}
+
+var (
+	ErrInvalidAmount   = errors.New("invalid amount")
+	ErrMissingCurrency = errors.New("missing currency")
+	ErrNegativeAmount  = errors.New("negative amount")
+)
+
+// currencyAliases maps commonly typed currency symbols and words to ISO 4217 codes.
+var currencyAliases = map[string]string{
+	"$":   "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"₴":   "UAH",
+	"ГРН": "UAH",
+	"zł":  "PLN",
+	"ZŁ":  "PLN",
+}
+
+// Parse parses a user supplied amount like "1500 UAH", "$49.99" or "1 500,50 грн".
+// If the input does not specify a currency, defaultCurrency is used.
+// ErrMissingCurrency is returned if neither is available.
+func Parse(input string, defaultCurrency string) (*Amount, error) {
+	return parse(input, defaultCurrency, false)
+}
+
+// parse parses an amount. If strict is true, currency codes must be typed in upper case,
+// so words following an amount are not mistaken for a currency.
+func parse(input string, defaultCurrency string, strict bool) (*Amount, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrInvalidAmount
+	}
+
+	var number, currency strings.Builder
+	for _, r := range input {
+		switch {
+		case unicode.IsDigit(r) || r == '.' || r == ',' || r == '-':
+			number.WriteRune(r)
+		case unicode.IsSpace(r):
+			continue
+		default:
+			currency.WriteRune(r)
+		}
+	}
+
+	value, err := parseMinorUnits(number.String())
+	if err != nil {
+		return nil, err
+	}
+
+	code := normalizeCurrency(currency.String())
+	if code == "" && currency.Len() > 0 {
+		return nil, ErrInvalidAmount
+	}
+	if strict && !isCurrencyAlias(currency.String()) && currency.String() != code {
+		return nil, ErrInvalidAmount
+	}
+	if code == "" {
+		code = normalizeCurrency(defaultCurrency)
+	}
+	if code == "" {
+		return nil, ErrMissingCurrency
+	}
+
+	return &Amount{Value: value, Currency: code}, nil
+}
+
+// ParsePrefix parses an amount at the start of the input, e.g. "200 EUR Christmas".
+// The amount and its currency may take up to two space separated tokens, the rest of the input is returned.
+// Currency codes must be upper case here, so "200 New Year" is 200 in the default currency for "New Year".
+func ParsePrefix(input string, defaultCurrency string) (*Amount, string, error) {
+	fields := strings.Fields(input)
+	err := ErrInvalidAmount
+	// the longest match wins, so "200 EUR" is not read as 200 in the default currency
+	for n := min(2, len(fields)); n > 0; n-- {
+		var amount *Amount
+		amount, err = parse(strings.Join(fields[:n], " "), defaultCurrency, true)
+		if err == nil {
+			return amount, strings.Join(fields[n:], " "), nil
+		}
+	}
+	return nil, "", err
+}
+
+// String formats the amount as "1500.00 UAH".
+func (a Amount) String() string {
+	sign := ""
+	value := a.Value
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, value/100, value%100, a.Currency)
+}
+
+// parseMinorUnits converts a decimal string to minor units.
+// Both '.' and ',' are accepted as the decimal separator. A separator followed by exactly three digits,
+// a separator that appears more than once and the first of two different separators separate thousands,
+// e.g. "1,500", "1.500.000" and "1,500.50". At most two fraction digits are accepted.
+func parseMinorUnits(number string) (int64, error) {
+	negative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(number, "-")
+	if number == "" || strings.Contains(number, "-") {
+		return 0, ErrInvalidAmount
+	}
+
+	integer, fraction := number, ""
+	dot, comma := strings.LastIndex(number, "."), strings.LastIndex(number, ",")
+	if decimal := max(dot, comma); decimal != -1 {
+		separator := number[decimal : decimal+1]
+		lone := strings.Count(number, separator) == 1
+		// the last separator is the decimal one, unless it can only separate thousands
+		if (dot != -1 && comma != -1) || (lone && len(number)-decimal-1 != 3) {
+			integer, fraction = number[:decimal], number[decimal+1:]
+			if fraction == "" || len(fraction) > 2 {
+				return 0, ErrInvalidAmount
+			}
+		}
+	}
+
+	integer, err := removeThousandsSeparators(integer)
+	if err != nil {
+		return 0, err
+	}
+	if integer == "" && fraction == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	var value int64
+	for _, r := range integer + (fraction + "00")[:2] {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidAmount
+		}
+		if value > (math.MaxInt64-9)/10 {
+			return 0, ErrInvalidAmount
+		}
+		value = value*10 + int64(r-'0')
+	}
+
+	if negative {
+		return 0, ErrNegativeAmount
+	}
+	return value, nil
+}
+
+// removeThousandsSeparators strips the separators from the integer part of a number, e.g. "1,500,000".
+// Groups after the first one must have exactly three digits.
+func removeThousandsSeparators(integer string) (string, error) {
+	groups := strings.FieldsFunc(integer, func(r rune) bool { return r == '.' || r == ',' })
+	if len(groups) <= 1 {
+		if strings.ContainsAny(integer, ".,") {
+			return "", ErrInvalidAmount
+		}
+		return integer, nil
+	}
+
+	// mixing separators within the integer part is not a number format
+	if strings.Contains(integer, ".") && strings.Contains(integer, ",") {
+		return "", ErrInvalidAmount
+	}
+	if len(groups[0]) > 3 || groups[0][0] == '0' || strings.Count(integer, integer[len(groups[0]):len(groups[0])+1]) != len(groups)-1 {
+		return "", ErrInvalidAmount
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", ErrInvalidAmount
+		}
+	}
+	return strings.Join(groups, ""), nil
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.TrimSpace(currency)
+	if currency == "" {
+		return ""
+	}
+	if code, ok := currencyAliases[currency]; ok {
+		return code
+	}
+	upper := strings.ToUpper(currency)
+	if code, ok := currencyAliases[upper]; ok {
+		return code
+	}
+	if !isoCurrencies[upper] {
+		return ""
+	}
+	return upper
+}
+
+// isCurrencyAlias returns true if the currency is a symbol or a word standing for a currency code, e.g. "$" or "грн".
+func isCurrencyAlias(currency string) bool {
+	currency = strings.TrimSpace(currency)
+	_, ok := currencyAliases[currency]
+	_, upperOk := currencyAliases[strings.ToUpper(currency)]
+	return ok || upperOk
+}
@@ -0,0 +1,75 @@
+package price
+
+import (
+	"regexp"
+	"strings"
+)
+
+var availabilityPattern = regexp.MustCompile(`(?is)<[a-z][a-z0-9]*\b[^>]*\bitemprop\s*=\s*["']?availability\b["']?[^>]*>`)
+
+// OutOfStock reports whether a page says that its product is no longer available.
+// Like prices, availability is read from JSON-LD, OpenGraph product tags and microdata.
+func OutOfStock(page []byte) bool {
+	text := string(page)
+
+	for _, data := range jsonLDBlocks(text) {
+		if availability := findAvailability(data); availability != "" {
+			return isUnavailable(availability)
+		}
+	}
+
+	properties := metaProperties(text)
+	for _, name := range []string{"product:availability", "og:availability"} {
+		if availability := properties[name]; availability != "" {
+			return isUnavailable(availability)
+		}
+	}
+
+	// e.g. <link itemprop="availability" href="https://schema.org/OutOfStock">
+	if tag := availabilityPattern.FindString(text); tag != "" {
+		attributes := parseAttributes(tag)
+		for _, name := range []string{"href", "content"} {
+			if availability := attributes[name]; availability != "" {
+				return isUnavailable(availability)
+			}
+		}
+	}
+
+	return false
+}
+
+// findAvailability walks JSON-LD data looking for the availability of an offer.
+func findAvailability(data any) string {
+	switch value := data.(type) {
+	case map[string]any:
+		if availability := jsonString(value["availability"]); availability != "" {
+			return availability
+		}
+		for _, key := range []string{"offers", "@graph", "mainEntity"} {
+			if availability := findAvailability(value[key]); availability != "" {
+				return availability
+			}
+		}
+	case []any:
+		for _, item := range value {
+			if availability := findAvailability(item); availability != "" {
+				return availability
+			}
+		}
+	}
+	return ""
+}
+
+// isUnavailable checks an availability value, either a schema.org item like "https://schema.org/OutOfStock"
+// or an OpenGraph value like "out of stock".
+func isUnavailable(availability string) bool {
+	availability = strings.ToLower(strings.TrimSpace(availability))
+	availability = availability[strings.LastIndex(availability, "/")+1:]
+	availability = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(availability)
+
+	switch availability {
+	case "outofstock", "soldout", "discontinued", "oos":
+		return true
+	}
+	return false
+}
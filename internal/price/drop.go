@@ -0,0 +1,14 @@
+package price
+
+import "github.com/aybolid/wishbot/internal/money"
+
+// Drop returns by how many percent a price fell from previous to current.
+// Returns false if the prices are in different currencies or the price fell by less than threshold percent.
+func Drop(previous money.Amount, current money.Amount, threshold int) (int64, bool) {
+	if previous.Currency != current.Currency || previous.Value <= 0 {
+		return 0, false
+	}
+
+	percent := (previous.Value - current.Value) * 100 / previous.Value
+	return percent, percent > 0 && percent >= int64(threshold)
+}
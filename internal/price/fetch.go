@@ -0,0 +1,110 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Fetcher downloads product pages.
+// The watcher only depends on this interface, so pages can be served from anywhere, e.g. a local fixture.
+type Fetcher interface {
+	Fetch(ctx context.Context, pageURL string) ([]byte, error)
+}
+
+const (
+	DEFAULT_FETCH_TIMEOUT = 15 * time.Second
+	// DEFAULT_MAX_PAGE_SIZE limits the amount of bytes read from a page. Prices are usually near the top.
+	DEFAULT_MAX_PAGE_SIZE = 2 << 20
+	USER_AGENT            = "Mozilla/5.0 (compatible; wishbot/1.0)"
+)
+
+var (
+	ErrUnsupportedURL = errors.New("unsupported url")
+	ErrPrivateAddress = errors.New("refusing to fetch a private network address")
+)
+
+// HTTPFetcher fetches pages over HTTP.
+type HTTPFetcher struct {
+	client      *http.Client
+	maxPageSize int64
+}
+
+// NewHTTPFetcher creates a fetcher for public http and https pages, see NewHTTPClient.
+func NewHTTPFetcher(allowPrivate bool) *HTTPFetcher {
+	return &HTTPFetcher{
+		client:      NewHTTPClient(allowPrivate),
+		maxPageSize: DEFAULT_MAX_PAGE_SIZE,
+	}
+}
+
+// NewHTTPClient creates a client for fetching pages that users linked to.
+// Wish urls come from users, so addresses in private networks are refused unless allowPrivate is set.
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: DEFAULT_FETCH_TIMEOUT}
+	if !allowPrivate {
+		// checked on connect, so redirects and DNS answers can't point to private addresses either
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   DEFAULT_FETCH_TIMEOUT,
+	}
+}
+
+// Fetch downloads a page, reading at most the maximum page size.
+func (f *HTTPFetcher) Fetch(ctx context.Context, pageURL string) ([]byte, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, ErrUnsupportedURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status fetching page: %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, f.maxPageSize))
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast()
+}
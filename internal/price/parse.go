@@ -0,0 +1,188 @@
+package price
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/aybolid/wishbot/internal/money"
+)
+
+var ErrNoPrice = errors.New("no price found on the page")
+
+var (
+	jsonLDPattern    = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	metaPattern      = regexp.MustCompile(`(?is)<meta\b[^>]*>`)
+	itempropPattern  = regexp.MustCompile(`(?is)<[a-z][a-z0-9]*\b[^>]*\bitemprop\s*=\s*["']?(pricecurrency|price)\b["']?[^>]*>([^<]*)`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Parse finds the price of the product on a page.
+// Structured data is tried first: JSON-LD, then OpenGraph product tags, then microdata.
+func Parse(page []byte) (*money.Amount, error) {
+	text := string(page)
+
+	for _, parse := range []func(string) (string, string){parseJSONLD, parseOpenGraph, parseMicrodata} {
+		amount, currency := parse(text)
+		if amount == "" || currency == "" {
+			continue
+		}
+		if price, err := parseAmount(amount, currency); err == nil {
+			return price, nil
+		}
+	}
+
+	return nil, ErrNoPrice
+}
+
+// parseJSONLD looks for a schema.org offer in the JSON-LD blocks of a page.
+func parseJSONLD(text string) (string, string) {
+	for _, data := range jsonLDBlocks(text) {
+		if amount, currency := findOffer(data); amount != "" {
+			return amount, currency
+		}
+	}
+	return "", ""
+}
+
+// jsonLDBlocks decodes the JSON-LD blocks of a page, skipping invalid ones.
+func jsonLDBlocks(text string) []any {
+	var blocks []any
+	for _, match := range jsonLDPattern.FindAllStringSubmatch(text, -1) {
+		var data any
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1])), &data); err != nil {
+			continue
+		}
+		blocks = append(blocks, data)
+	}
+	return blocks
+}
+
+// findOffer walks JSON-LD data looking for an object with a price and a currency.
+// Products nest their offers, pages may list several entities in arrays or in "@graph".
+func findOffer(data any) (string, string) {
+	switch value := data.(type) {
+	case map[string]any:
+		currency := jsonString(value["priceCurrency"])
+		for _, key := range []string{"price", "lowPrice"} {
+			if amount := jsonString(value[key]); amount != "" && currency != "" {
+				return amount, currency
+			}
+		}
+		// a price specification may hold the price of an offer
+		for _, key := range []string{"offers", "priceSpecification", "@graph", "mainEntity"} {
+			if amount, currency := findOffer(value[key]); amount != "" {
+				return amount, currency
+			}
+		}
+	case []any:
+		for _, item := range value {
+			if amount, currency := findOffer(item); amount != "" {
+				return amount, currency
+			}
+		}
+	}
+	return "", ""
+}
+
+func jsonString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.2f", v)
+	}
+	return ""
+}
+
+// parseOpenGraph reads the product price meta tags, e.g. <meta property="product:price:amount" content="49.99">.
+func parseOpenGraph(text string) (string, string) {
+	properties := metaProperties(text)
+	for _, prefix := range []string{"product:price:", "og:price:"} {
+		if amount := properties[prefix+"amount"]; amount != "" {
+			return amount, properties[prefix+"currency"]
+		}
+	}
+	return "", ""
+}
+
+// metaProperties maps the lower cased property or name of meta tags to their content.
+func metaProperties(text string) map[string]string {
+	properties := make(map[string]string)
+	for _, tag := range metaPattern.FindAllString(text, -1) {
+		attributes := parseAttributes(tag)
+		name := attributes["property"]
+		if name == "" {
+			name = attributes["name"]
+		}
+		if name != "" {
+			properties[strings.ToLower(name)] = attributes["content"]
+		}
+	}
+	return properties
+}
+
+// parseMicrodata reads schema.org microdata, e.g. <span itemprop="price" content="49.99">$49.99</span>.
+// The content attribute is preferred over the text, which is often formatted for humans.
+func parseMicrodata(text string) (string, string) {
+	var amount, currency string
+	for _, match := range itempropPattern.FindAllStringSubmatch(text, -1) {
+		value, ok := parseAttributes(match[0])["content"]
+		if !ok {
+			value = match[2]
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(match[1]) {
+		case "price":
+			if amount == "" {
+				amount = value
+			}
+		case "pricecurrency":
+			if currency == "" {
+				currency = value
+			}
+		}
+	}
+	return amount, currency
+}
+
+// parseAttributes parses the attributes of an html tag, lower casing their names.
+func parseAttributes(tag string) map[string]string {
+	attributes := make(map[string]string)
+	for _, match := range attributePattern.FindAllStringSubmatch(tag, -1) {
+		attributes[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return attributes
+}
+
+// parseAmount parses a price as found on a page, e.g. "1299", "1 299,00", "1,299.00" or "1.299".
+func parseAmount(amount string, currency string) (*money.Amount, error) {
+	amount = strings.Map(func(r rune) rune {
+		// spaces, including non-breaking ones, separate thousands
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, html.UnescapeString(amount))
+
+	// with both separators present, the first one separates thousands
+	dot, comma := strings.LastIndex(amount, "."), strings.LastIndex(amount, ",")
+	switch {
+	case dot != -1 && comma != -1 && comma < dot:
+		amount = strings.ReplaceAll(amount, ",", "")
+	case dot != -1 && comma != -1 && dot < comma:
+		amount = strings.ReplaceAll(amount, ".", "")
+	case dot != -1 && strings.Count(amount, ".") == 1 && len(amount)-dot-1 == 3:
+		// a lone separator followed by three digits separates thousands, e.g. "1.299"
+		amount = strings.Replace(amount, ".", "", 1)
+	case comma != -1 && strings.Count(amount, ",") == 1 && len(amount)-comma-1 == 3:
+		amount = strings.Replace(amount, ",", "", 1)
+	}
+
+	return money.Parse(amount+" "+currency, "")
+}
@@ -0,0 +1,188 @@
+package price
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aybolid/wishbot/internal/money"
+)
+
+// fixtures are served by a local server, keyed by path.
+var fixtures = map[string]string{
+	"/jsonld": `<html><head>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Product", "name": "Headphones",
+ "offers": {"@type": "Offer", "price": "49.99", "priceCurrency": "USD", "availability": "https://schema.org/InStock"}}
+</script>
+</head><body></body></html>`,
+	"/jsonld-graph": `<script type="application/ld+json">
+{"@graph": [{"@type": "WebPage"}, {"@type": "Product", "offers": [{"price": 1299, "priceCurrency": "UAH"}]}]}
+</script>`,
+	"/opengraph": `<meta property="product:price:amount" content="1,299">
+<meta property="product:price:currency" content="USD">`,
+	"/opengraph-dot": `<meta property="og:price:amount" content="1.299">
+<meta property="og:price:currency" content="EUR">`,
+	"/microdata": `<div itemscope itemtype="https://schema.org/Product">
+<span itemprop="price" content="1 299,50">1 299,50 грн</span>
+<meta itemprop="priceCurrency" content="UAH">
+<link itemprop="availability" href="https://schema.org/OutOfStock">
+</div>`,
+	"/microdata-text": `<span itemprop="priceCurrency">EUR</span> <span itemprop="price">1.299,00</span>`,
+	"/decimal": `<meta property="product:price:amount" content="12,50">
+<meta property="product:price:currency" content="PLN">`,
+	"/none": `<html><body>No structured data here.</body></html>`,
+}
+
+func newFixtureServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchAndParse(t *testing.T) {
+	server := newFixtureServer(t)
+	fetcher := NewHTTPFetcher(true)
+
+	tests := []struct {
+		path       string
+		want       *money.Amount
+		outOfStock bool
+	}{
+		{path: "/jsonld", want: &money.Amount{Value: 4999, Currency: "USD"}},
+		{path: "/jsonld-graph", want: &money.Amount{Value: 129900, Currency: "UAH"}},
+		{path: "/opengraph", want: &money.Amount{Value: 129900, Currency: "USD"}},
+		{path: "/opengraph-dot", want: &money.Amount{Value: 129900, Currency: "EUR"}},
+		{path: "/microdata", want: &money.Amount{Value: 129950, Currency: "UAH"}, outOfStock: true},
+		{path: "/microdata-text", want: &money.Amount{Value: 129900, Currency: "EUR"}},
+		{path: "/decimal", want: &money.Amount{Value: 1250, Currency: "PLN"}},
+		{path: "/none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			page, err := fetcher.Fetch(context.Background(), server.URL+tt.path)
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			got, err := Parse(page)
+			if tt.want == nil {
+				if err != ErrNoPrice {
+					t.Fatalf("Parse() = %v, %v, want ErrNoPrice", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+
+			if OutOfStock(page) != tt.outOfStock {
+				t.Errorf("OutOfStock() = %v, want %v", !tt.outOfStock, tt.outOfStock)
+			}
+		})
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := newFixtureServer(t)
+
+	if _, err := NewHTTPFetcher(true).Fetch(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("Fetch() of a missing page succeeded")
+	}
+	if _, err := NewHTTPFetcher(false).Fetch(context.Background(), server.URL+"/jsonld"); err == nil {
+		t.Error("Fetch() of a private address succeeded")
+	}
+	if _, err := NewHTTPFetcher(true).Fetch(context.Background(), "ftp://example.com"); err != ErrUnsupportedURL {
+		t.Errorf("Fetch() of an ftp url error = %v, want ErrUnsupportedURL", err)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{amount: "1299", currency: "USD", want: 129900},
+		{amount: "1,299", currency: "USD", want: 129900},
+		{amount: "1.299", currency: "EUR", want: 129900},
+		{amount: "1,299.00", currency: "USD", want: 129900},
+		{amount: "1.299,00", currency: "EUR", want: 129900},
+		{amount: "1&nbsp;299,00", currency: "UAH", want: 129900},
+		{amount: "1.299.000", currency: "UAH", want: 129900000},
+		{amount: "49.99", currency: "USD", want: 4999},
+		{amount: "49,9", currency: "EUR", want: 4990},
+		{amount: "49.9999", currency: "USD", wantErr: true},
+		{amount: "free", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := parseAmount(tt.amount, tt.currency)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAmount() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAmount() error = %v", err)
+			}
+			if got.Value != tt.want || got.Currency != tt.currency {
+				t.Errorf("parseAmount() = %v, want %d %s", got, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+// TestDrop covers the threshold the price watcher notifies members at.
+func TestDrop(t *testing.T) {
+	const threshold = 10
+
+	tests := []struct {
+		name     string
+		previous money.Amount
+		current  money.Amount
+		percent  int64
+		ok       bool
+	}{
+		{name: "above threshold", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 8000, Currency: "USD"}, percent: 20, ok: true},
+		{name: "at threshold", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 9000, Currency: "USD"}, percent: 10, ok: true},
+		{name: "below threshold", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 9500, Currency: "USD"}, percent: 5},
+		{name: "unchanged", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 10000, Currency: "USD"}},
+		{name: "increase", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 12000, Currency: "USD"}, percent: -20},
+		{name: "other currency", previous: money.Amount{Value: 10000, Currency: "USD"}, current: money.Amount{Value: 100, Currency: "EUR"}},
+		{name: "thousands format", previous: money.Amount{Value: 129900, Currency: "USD"}, current: mustParseAmount(t, "1,299", "USD")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			percent, ok := Drop(tt.previous, tt.current, threshold)
+			if percent != tt.percent || ok != tt.ok {
+				t.Errorf("Drop() = %d, %v, want %d, %v", percent, ok, tt.percent, tt.ok)
+			}
+		})
+	}
+}
+
+func mustParseAmount(t *testing.T, amount string, currency string) money.Amount {
+	parsed, err := parseAmount(amount, currency)
+	if err != nil {
+		t.Fatalf("parseAmount(%q) error = %v", amount, err)
+	}
+	return *parsed
+}
@@ -0,0 +1,430 @@
+package tgbot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const MY_DATA_FILE_NAME = "wishbot-data.json"
+
+// userDataExport is the document sent by /mydata.
+// It holds everything stored about a user.
+type userDataExport struct {
+	Profile       profileExport        `json:"profile"`
+	Groups        []groupExport        `json:"groups"`
+	Wishes        []wishExport         `json:"wishes"`
+	Contributions []contributionExport `json:"contributions"`
+	Budgets       []budgetExport       `json:"budgets"`
+	Purchases     []purchaseExport     `json:"purchases"`
+	Templates     []templateExport     `json:"templates"`
+}
+
+type profileExport struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username,omitempty"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	ChatID    int64  `json:"chat_id"`
+	Language  string `json:"language"`
+	Timezone  string `json:"timezone"`
+	// QuietHours are formatted like "22:00-08:00", empty if off.
+	QuietHours string `json:"quiet_hours,omitempty"`
+	// Birthday is formatted like "24.12" or "24.12.1990", empty if not shared.
+	Birthday       string `json:"birthday,omitempty"`
+	ClothingSize   string `json:"clothing_size,omitempty"`
+	ShoeSize       string `json:"shoe_size,omitempty"`
+	RingSize       string `json:"ring_size,omitempty"`
+	FavoriteColors string `json:"favorite_colors,omitempty"`
+	Allergies      string `json:"allergies,omitempty"`
+	Dislikes       string `json:"dislikes,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+type groupExport struct {
+	GroupID  int64  `json:"group_id"`
+	Name     string `json:"name"`
+	IsOwner  bool   `json:"is_owner"`
+	JoinedAt string `json:"joined_at"`
+}
+
+type wishExport struct {
+	WishID      int64         `json:"wish_id"`
+	GroupID     int64         `json:"group_id"`
+	URL         string        `json:"url"`
+	Description string        `json:"description,omitempty"`
+	Position    int           `json:"position"`
+	CreatedAt   string        `json:"created_at"`
+	Prices      []priceExport `json:"prices,omitempty"`
+}
+
+type priceExport struct {
+	Amount    string `json:"amount"`
+	CreatedAt string `json:"created_at"`
+	CheckedAt string `json:"checked_at"`
+}
+
+type contributionExport struct {
+	WishID    int64  `json:"wish_id"`
+	Amount    string `json:"amount"`
+	CreatedAt string `json:"created_at"`
+}
+
+type budgetExport struct {
+	GroupID   int64  `json:"group_id"`
+	Occasion  string `json:"occasion,omitempty"`
+	Amount    string `json:"amount"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type purchaseExport struct {
+	GroupID   int64  `json:"group_id"`
+	WishID    int64  `json:"wish_id,omitempty"`
+	WishURL   string `json:"wish_url"`
+	Occasion  string `json:"occasion,omitempty"`
+	Amount    string `json:"amount"`
+	CreatedAt string `json:"created_at"`
+}
+
+type templateExport struct {
+	TemplateID int64   `json:"template_id"`
+	Name       string  `json:"name"`
+	Text       string  `json:"text"`
+	GroupIDs   []int64 `json:"group_ids,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+func handleMyData(ctx *handleContext) error {
+	export, err := exportUserData(ctx.user)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	doc := tgbotapi.NewDocument(ctx.msg.Chat.ID, tgbotapi.FileBytes{Name: MY_DATA_FILE_NAME, Bytes: data})
+	doc.Caption = ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "myDataCaption",
+		},
+	)
+	bot.HandledSend(doc)
+
+	return nil
+}
+
+// exportUserData collects everything stored about a user.
+func exportUserData(user *db.User) (*userDataExport, error) {
+	quietHours := ""
+	if user.HasQuietHours() {
+		quietHours = formatMinutes(user.QuietStart) + "-" + formatMinutes(user.QuietEnd)
+	}
+
+	birthday := ""
+	if b, err := db.GetBirthday(user.UserID); err == nil {
+		birthday = formatBirthday(b.Day, b.Month, b.Year)
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	profile, err := db.GetProfile(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &userDataExport{
+		Profile: profileExport{
+			UserID:         user.UserID,
+			Username:       user.Username,
+			FirstName:      user.FirstName,
+			LastName:       user.LastName,
+			ChatID:         user.ChatID,
+			Language:       user.Language,
+			Timezone:       user.Timezone,
+			QuietHours:     quietHours,
+			Birthday:       birthday,
+			ClothingSize:   profile.ClothingSize,
+			ShoeSize:       profile.ShoeSize,
+			RingSize:       profile.RingSize,
+			FavoriteColors: profile.FavoriteColors,
+			Allergies:      profile.Allergies,
+			Dislikes:       profile.Dislikes,
+			CreatedAt:      user.CreatedAt,
+			UpdatedAt:      user.UpdatedAt,
+		},
+		Groups:        []groupExport{},
+		Wishes:        []wishExport{},
+		Contributions: []contributionExport{},
+		Budgets:       []budgetExport{},
+		Purchases:     []purchaseExport{},
+		Templates:     []templateExport{},
+	}
+
+	groups, err := db.GetUserGroups(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		member, err := db.GetGroupMember(group.GroupID, user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		export.Groups = append(export.Groups, groupExport{
+			GroupID:  group.GroupID,
+			Name:     group.Name,
+			IsOwner:  group.OwnerID == user.UserID,
+			JoinedAt: member.CreatedAt,
+		})
+
+		wishes, err := db.GetUserWishes(user.UserID, group.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, wish := range wishes {
+			prices, err := db.GetWishPrices(wish.WishID)
+			if err != nil {
+				return nil, err
+			}
+
+			exported := wishExport{
+				WishID:      wish.WishID,
+				GroupID:     wish.GroupID,
+				URL:         wish.URL,
+				Description: wish.Description,
+				Position:    wish.Position,
+				CreatedAt:   wish.CreatedAt,
+			}
+			for _, price := range prices {
+				exported.Prices = append(exported.Prices, priceExport{
+					Amount:    price.Amount.String(),
+					CreatedAt: price.CreatedAt,
+					CheckedAt: price.CheckedAt,
+				})
+			}
+			export.Wishes = append(export.Wishes, exported)
+		}
+	}
+
+	contributions, err := db.GetUserContributions(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, contribution := range contributions {
+		export.Contributions = append(export.Contributions, contributionExport{
+			WishID:    contribution.WishID,
+			Amount:    contribution.Amount.String(),
+			CreatedAt: contribution.CreatedAt,
+		})
+	}
+
+	budgets, err := db.GetUserBudgets(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, budget := range budgets {
+		export.Budgets = append(export.Budgets, budgetExport{
+			GroupID:   budget.GroupID,
+			Occasion:  budget.Occasion,
+			Amount:    budget.Amount.String(),
+			UpdatedAt: budget.UpdatedAt,
+		})
+	}
+
+	purchases, err := db.GetUserPurchases(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, purchase := range purchases {
+		export.Purchases = append(export.Purchases, purchaseExport{
+			GroupID:   purchase.GroupID,
+			WishID:    purchase.WishID,
+			WishURL:   purchase.WishURL,
+			Occasion:  purchase.Occasion,
+			Amount:    purchase.Amount.String(),
+			CreatedAt: purchase.CreatedAt,
+		})
+	}
+
+	templates, err := db.GetUserTemplates(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, template := range templates {
+		groupIDs, err := db.GetTemplateGroupIDs(template.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		export.Templates = append(export.Templates, templateExport{
+			TemplateID: template.TemplateID,
+			Name:       template.Name,
+			Text:       template.Text,
+			GroupIDs:   groupIDs,
+			CreatedAt:  template.CreatedAt,
+			UpdatedAt:  template.UpdatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+func handleForgetMe(ctx *handleContext) error {
+	groups, err := db.GetOwnedGroups(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "forgetMe",
+		},
+	)}
+
+	// tell the user what happens to the groups they own
+	for _, group := range groups {
+		successor, err := db.GetGroupSuccessor(group.GroupID, ctx.user.UserID)
+		if err == sql.ErrNoRows {
+			lines = append(lines, ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "forgetMeDeleteGroup",
+					TemplateData: map[string]any{
+						"GroupName": html.EscapeString(group.Name),
+					},
+				},
+			))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		successorUser, err := db.GetUser(successor.UserID)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "forgetMeTransferGroup",
+				TemplateData: map[string]any{
+					"GroupName": html.EscapeString(group.Name),
+					"Username":  html.EscapeString(successorUser.DisplayName()),
+				},
+			},
+		))
+	}
+
+	return sendAreYouSure(
+		&areYouSureConfig{
+			localizer:    ctx.localizer,
+			chatID:       ctx.msg.Chat.ID,
+			message:      strings.Join(lines, "\n"),
+			actionID:     FORGET_ME_ACTION,
+			callbackData: fmt.Sprintf("%d", ctx.user.UserID),
+		},
+	)
+}
+
+func handleForgetMeConfirmed(dataOffset int, ctx *handleContext) error {
+	userID, err := strconv.ParseInt(ctx.callbackQuery.Data[dataOffset:], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if userID != ctx.callbackQuery.From.ID {
+		logger.Sugared.Errorw("user tried to delete another user", "user_id", ctx.callbackQuery.From.ID, "target_user_id", userID)
+		return nil
+	}
+
+	// groups are fetched before the memberships are gone
+	groups, err := db.GetUserGroups(userID)
+	if err != nil {
+		return err
+	}
+
+	newOwners, err := db.DeleteUser(userID)
+	if err != nil {
+		return err
+	}
+	State.releaseUser(userID)
+
+	logger.Sugared.Infow("user deleted their account", "user_id", userID, "transferred_groups", newOwners)
+
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "forgotYou",
+		},
+	))
+	bot.HandledSend(edit)
+
+	displayName := ctx.user.DisplayName()
+
+	for _, group := range groups {
+		if group.OwnerID == userID {
+			newOwnerID, ok := newOwners[group.GroupID]
+			if !ok {
+				// the group was deleted along with the user
+				continue
+			}
+			group.OwnerID = newOwnerID
+			notifyNewGroupOwner(group)
+		}
+
+		err := notifyGroup(group, userID, func(localizer *locals.Localizer) string {
+			return localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "userForgotNotification",
+					TemplateData: map[string]any{
+						"Username":  displayName,
+						"GroupName": group.Name,
+					},
+				},
+			)
+		})
+		if err != nil {
+			logger.Sugared.Errorw("failed to notify group about deleted user", "group_id", group.GroupID, "err", err)
+		}
+	}
+
+	return nil
+}
+
+// notifyNewGroupOwner lets a member know they took over a group.
+func notifyNewGroupOwner(group *db.Group) {
+	go func() {
+		owner, err := db.GetUser(group.OwnerID)
+		if err != nil {
+			logger.Sugared.Errorw("error getting user for notification", "user_id", group.OwnerID, "error", err)
+			return
+		}
+
+		ownerLocalizer := locals.GetLocalizer(owner.Language)
+
+		msg := tgbotapi.NewMessage(
+			owner.ChatID,
+			ownerLocalizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "groupTransferredNotification",
+					TemplateData: map[string]any{
+						"GroupName": group.Name,
+					},
+				},
+			),
+		)
+		bot.HandledSend(msg)
+	}()
+}
@@ -0,0 +1,472 @@
+package tgbot
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// FIND_USER_LIMIT limits the amount of users listed by /finduser.
+const FIND_USER_LIMIT = 20
+
+// ADMIN_LOG_LIMIT limits the amount of actions listed by /adminlog.
+const ADMIN_LOG_LIMIT = 20
+
+// ADMIN_LOG_ARGS_LIMIT limits the length of the arguments of a single action in /adminlog, e.g. broadcast texts.
+const ADMIN_LOG_ARGS_LIMIT = 200
+
+// BROADCAST_INTERVAL keeps broadcasts below the telegram limit of 30 messages per second.
+const BROADCAST_INTERVAL = 50 * time.Millisecond
+
+var groupIDArg = argSpec{kind: ID_ARG, nameMessageID: "argGroupID"}
+
+// adminCommands are the commands available to the bot operators in private chats, see env.Vars.AdminUserIDs.
+// They are unknown commands for everyone else.
+var adminCommands = []*command{
+	{name: "stats", handler: handleStats, descriptionMessageID: "commandStats"},
+	{
+		name:                 "broadcast",
+		handler:              handleBroadcast,
+		args:                 []argSpec{{kind: TEXT_ARG, nameMessageID: "argBroadcastText"}},
+		descriptionMessageID: "commandBroadcast",
+	},
+	{
+		name:                 "finduser",
+		handler:              handleFindUser,
+		args:                 []argSpec{{kind: TEXT_ARG, nameMessageID: "argUserQuery"}},
+		descriptionMessageID: "commandFindUser",
+	},
+	{
+		name:                 "inspectgroup",
+		handler:              handleInspectGroup,
+		args:                 []argSpec{groupIDArg},
+		descriptionMessageID: "commandInspectGroup",
+	},
+	{
+		name:                 "deletegroup",
+		handler:              handleAdminDeleteGroup,
+		args:                 []argSpec{groupIDArg},
+		descriptionMessageID: "commandDeleteGroup",
+	},
+	{name: "adminlog", handler: handleAdminLog, descriptionMessageID: "commandAdminLog"},
+}
+
+// auditAdminAction stores an action of a bot operator, see /adminlog.
+// Every admin action must be audited, including denied ones.
+func auditAdminAction(adminID int64, action string, keysAndValues ...any) {
+	logger.Sugared.Infow("admin action", append([]any{"admin_id", adminID, "action", action}, keysAndValues...)...)
+
+	args := make([]string, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		args = append(args, fmt.Sprintf("%v=%v", keysAndValues[i], keysAndValues[i+1]))
+	}
+	if err := db.RecordAdminAction(adminID, action, strings.Join(args, " ")); err != nil {
+		logger.Sugared.Errorw("failed to record admin action", "admin_id", adminID, "action", action, "err", err)
+	}
+}
+
+func handleAdminLog(ctx *handleContext) error {
+	auditAdminAction(ctx.user.UserID, "admin_log")
+
+	actions, err := db.GetAdminActions(ADMIN_LOG_LIMIT)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "adminLogHeader",
+		},
+	)}
+	length := utf8.RuneCountInString(lines[0])
+	for _, action := range actions {
+		line := ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "adminLogEntry",
+				TemplateData: map[string]any{
+					"Time":    formatUserTime(ctx.user, action.CreatedAt),
+					"AdminID": action.AdminID,
+					"Action":  html.EscapeString(action.Action),
+					"Args":    html.EscapeString(truncateText(action.Args, ADMIN_LOG_ARGS_LIMIT)),
+				},
+			},
+		)
+		// older actions are left out rather than cutting the html in half
+		length += utf8.RuneCountInString(line) + 2
+		if length > MESSAGE_TEXT_LIMIT {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, strings.Join(lines, "\n\n"))
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handleStats(ctx *handleContext) error {
+	auditAdminAction(ctx.user.UserID, "stats")
+
+	stats, err := db.GetStats()
+	if err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "adminStats",
+			TemplateData: map[string]any{
+				"Users":       stats.Users,
+				"Groups":      stats.Groups,
+				"BoundGroups": stats.BoundGroups,
+				"Members":     stats.Members,
+				"Wishes":      stats.Wishes,
+				"Pools":       stats.Pools,
+				"Pending":     State.pendingCount(),
+			},
+		},
+	))
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handleBroadcast(ctx *handleContext) error {
+	texts := parseBroadcastTexts(ctx.args.text)
+	auditAdminAction(ctx.user.UserID, "broadcast", "texts", texts)
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:   "broadcastStarted",
+			PluralCount: len(users),
+			TemplateData: map[string]any{
+				"UserCount": len(users),
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	go func() {
+		sent, failed := 0, 0
+		for _, user := range users {
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			msg := tgbotapi.NewMessage(user.ChatID, userLocalizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "broadcast",
+					TemplateData: map[string]any{
+						"Text": getBroadcastText(texts, user.Language),
+					},
+				},
+			))
+			if _, err := bot.Send(msg); err != nil {
+				logger.Sugared.Errorw("failed to send broadcast", "user_id", user.UserID, "err", err)
+				failed++
+			} else {
+				sent++
+			}
+
+			time.Sleep(BROADCAST_INTERVAL)
+		}
+
+		auditAdminAction(ctx.user.UserID, "broadcast_done", "sent", sent, "failed", failed)
+
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "broadcastDone",
+				TemplateData: map[string]any{
+					"Sent":   sent,
+					"Failed": failed,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+	}()
+
+	return nil
+}
+
+// parseBroadcastTexts splits a broadcast into texts per language.
+// A line starting with a supported language and a colon, e.g. "uk:", starts the text for that language.
+// Text before the first such line is stored under an empty language and is meant for everyone.
+func parseBroadcastTexts(text string) map[string]string {
+	texts := make(map[string]string)
+	lang := ""
+
+	for _, line := range strings.Split(text, "\n") {
+		if prefix, rest, ok := strings.Cut(line, ":"); ok && locals.IsSupported(strings.TrimSpace(prefix)) {
+			lang = strings.TrimSpace(prefix)
+			line = rest
+		}
+		texts[lang] += line + "\n"
+	}
+
+	for lang, text := range texts {
+		texts[lang] = strings.TrimSpace(text)
+		if texts[lang] == "" {
+			delete(texts, lang)
+		}
+	}
+
+	return texts
+}
+
+// getBroadcastText picks the broadcast text for a language.
+// Falls back to the text meant for everyone, then to English.
+func getBroadcastText(texts map[string]string, lang string) string {
+	for _, candidate := range []string{lang, "", locals.ENGLISH} {
+		if text, ok := texts[candidate]; ok {
+			return text
+		}
+	}
+	// only languages nobody else reads were passed
+	for _, text := range texts {
+		return text
+	}
+	return ""
+}
+
+func handleFindUser(ctx *handleContext) error {
+	auditAdminAction(ctx.user.UserID, "find_user", "query", ctx.args.text)
+
+	users, err := db.FindUsers(ctx.args.text, FIND_USER_LIMIT)
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "adminNoUsersFound",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	lines := make([]string, len(users))
+	for i, user := range users {
+		groups, err := db.GetUserGroups(user.UserID)
+		if err != nil {
+			return err
+		}
+
+		lines[i] = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID:   "adminUserEntry",
+				PluralCount: len(groups),
+				TemplateData: map[string]any{
+					"Name":       html.EscapeString(getFullName(user)),
+					"UserID":     user.UserID,
+					"Language":   user.Language,
+					"GroupCount": len(groups),
+					"CreatedAt":  formatUserTime(ctx.user, user.CreatedAt),
+				},
+			},
+		)
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, strings.Join(lines, "\n\n"))
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// getFullName returns the display name of a user along with the name if the user has a username.
+func getFullName(user *db.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.Username == "" || name == "" {
+		return user.DisplayName()
+	}
+	return fmt.Sprintf("%s (%s)", user.DisplayName(), name)
+}
+
+func handleInspectGroup(ctx *handleContext) error {
+	auditAdminAction(ctx.user.UserID, "inspect_group", "group_id", ctx.args.id)
+
+	group, ok := getAdminArgGroup(ctx)
+	if !ok {
+		return nil
+	}
+
+	owner, err := db.GetUser(group.OwnerID)
+	if err != nil {
+		return err
+	}
+	members, err := db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	memberLines := make([]string, len(members))
+	for i, member := range members {
+		user, err := db.GetUser(member.UserID)
+		if err != nil {
+			return err
+		}
+		wishes, err := db.GetUserWishes(member.UserID, group.GroupID)
+		if err != nil {
+			return err
+		}
+
+		memberLines[i] = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID:   "adminGroupMember",
+				PluralCount: len(wishes),
+				TemplateData: map[string]any{
+					"Name":      html.EscapeString(getFullName(user)),
+					"UserID":    user.UserID,
+					"WishCount": len(wishes),
+				},
+			},
+		)
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "adminGroupInfo",
+			TemplateData: map[string]any{
+				"GroupID":   group.GroupID,
+				"GroupName": html.EscapeString(group.Name),
+				"Owner":     html.EscapeString(getFullName(owner)),
+				"ChatID":    group.ChatID,
+				"CreatedAt": formatUserTime(ctx.user, group.CreatedAt),
+				"Members":   strings.Join(memberLines, "\n"),
+			},
+		},
+	))
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handleAdminDeleteGroup(ctx *handleContext) error {
+	auditAdminAction(ctx.user.UserID, "delete_group_requested", "group_id", ctx.args.id)
+
+	group, ok := getAdminArgGroup(ctx)
+	if !ok {
+		return nil
+	}
+
+	return sendAreYouSure(
+		&areYouSureConfig{
+			localizer: ctx.localizer,
+			chatID:    ctx.msg.Chat.ID,
+			message: ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "adminDeleteGroup",
+					TemplateData: map[string]any{
+						"GroupID":   group.GroupID,
+						"GroupName": html.EscapeString(group.Name),
+					},
+				},
+			),
+			actionID:     ADMIN_DELETE_GROUP_ACTION,
+			callbackData: fmt.Sprintf("%d", group.GroupID),
+		},
+	)
+}
+
+// getAdminArgGroup returns the group passed by id to an admin command.
+// If the group doesn't exist, a reply is sent and false is returned.
+func getAdminArgGroup(ctx *handleContext) (*db.Group, bool) {
+	group, err := db.GetGroup(ctx.args.id)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group for admin command", "group_id", ctx.args.id, "err", err)
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "adminGroupNotFound",
+				TemplateData: map[string]any{
+					"GroupID": ctx.args.id,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil, false
+	}
+	return group, true
+}
+
+func handleAdminDeleteGroupConfirmed(dataOffset int, ctx *handleContext) error {
+	groupID, err := strconv.ParseInt(ctx.callbackQuery.Data[dataOffset:], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	// admin rights may be revoked before the confirmation
+	if !env.Vars.IsAdmin(ctx.callbackQuery.From.ID) {
+		auditAdminAction(ctx.callbackQuery.From.ID, "delete_group_denied", "group_id", groupID)
+		return nil
+	}
+
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+	members, err := db.GetGroupMembers(groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.DeleteGroup(groupID); err != nil {
+		return err
+	}
+	auditAdminAction(ctx.callbackQuery.From.ID, "delete_group", "group_id", groupID, "group_name", group.Name, "owner_id", group.OwnerID)
+
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "adminGroupDeleted",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	))
+	bot.HandledSend(edit)
+
+	for _, member := range members {
+		go func() {
+			user, err := db.GetUser(member.UserID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", member.UserID, "error", err)
+				return
+			}
+
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			msg := tgbotapi.NewMessage(
+				user.ChatID,
+				userLocalizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "groupDeletedByAdminNotification",
+						TemplateData: map[string]any{
+							"GroupName": group.Name,
+						},
+					},
+				),
+			)
+			bot.HandledSend(msg)
+		}()
+	}
+
+	return nil
+}
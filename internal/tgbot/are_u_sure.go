@@ -21,14 +21,21 @@ const (
 	LEAVE_GROUP_ACTION = iota
 	DELETE_WISH_ACTION
 	KICK_MEMBER_ACTION
+	FORGET_ME_ACTION
+	ADMIN_DELETE_GROUP_ACTION
+	ADD_DUPLICATE_WISH_ACTION
+	DELETE_TEMPLATE_ACTION
 )
 
 type areYouSureConfig struct {
-	localizer    *i18n.Localizer
+	localizer    *locals.Localizer
 	chatID       int64
 	message      string
 	actionID     int
 	callbackData string
+	// messageID is the message turned into the confirmation, e.g. the menu the action was picked from.
+	// A new message is sent if it is 0.
+	messageID int
 }
 
 type actionHandler = func(int, *handleContext) error
@@ -37,6 +44,11 @@ var actionHandlers = map[int]actionHandler{
 	LEAVE_GROUP_ACTION: handleGroupLeave,
 	DELETE_WISH_ACTION: handleDeleteWish,
 	KICK_MEMBER_ACTION: handleKickMember,
+	FORGET_ME_ACTION:   handleForgetMeConfirmed,
+
+	ADMIN_DELETE_GROUP_ACTION: handleAdminDeleteGroupConfirmed,
+	ADD_DUPLICATE_WISH_ACTION: handleAddDuplicateWish,
+	DELETE_TEMPLATE_ACTION:    handleDeleteTemplate,
 }
 
 func sendAreYouSure(config *areYouSureConfig) error {
@@ -46,9 +58,8 @@ func sendAreYouSure(config *areYouSureConfig) error {
 		},
 	)
 	text += fmt.Sprintf("\n\n%s", config.message)
-	msg := tgbotapi.NewMessage(config.chatID, text)
 
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(config.localizer.MustLocalize(
 				&i18n.LocalizeConfig{
@@ -68,14 +79,30 @@ func sendAreYouSure(config *areYouSureConfig) error {
 			),
 		),
 	)
-	msg.ParseMode = tgbotapi.ModeHTML
 
+	if config.messageID != 0 {
+		edit := tgbotapi.NewEditMessageTextAndMarkup(config.chatID, config.messageID, text, keyboard)
+		edit.ParseMode = tgbotapi.ModeHTML
+		bot.HandledSend(edit)
+		return nil
+	}
+
+	msg := tgbotapi.NewMessage(config.chatID, text)
+	msg.ReplyMarkup = keyboard
+	msg.ParseMode = tgbotapi.ModeHTML
 	bot.HandledSend(msg)
 
 	return nil
 }
 
 func handleNo(ctx *handleContext) error {
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "actionCancelled",
+		},
+	))
+	bot.HandledSend(edit)
+
 	return nil
 }
 
@@ -122,21 +149,21 @@ func handleKickMember(dataOffset int, ctx *handleContext) error {
 		return err
 	}
 
-	err = db.DeleteGroupMember(groupID, userID)
+	err = db.DeleteGroupMember(groupID, userID, ctx.callbackQuery.From.ID)
 	if err != nil {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "youKickedMember",
 			TemplateData: map[string]any{
-				"Username":  user.Username,
+				"Username":  user.DisplayName(),
 				"GroupName": group.Name,
 			},
 		},
 	))
-	bot.HandledSend(resp)
+	bot.HandledSend(edit)
 
 	go func() {
 		userLocalizer := locals.GetLocalizer(user.Language)
@@ -164,17 +191,17 @@ func handleDeleteWish(dataOffset int, ctx *handleContext) error {
 		return err
 	}
 
-	err = db.DeleteWish(wishID)
+	err = db.DeleteWish(wishID, ctx.callbackQuery.From.ID)
 	if err != nil {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "wishDeleted",
 		},
 	))
-	bot.HandledSend(resp)
+	bot.HandledSend(edit)
 
 	return nil
 }
@@ -194,32 +221,29 @@ func handleGroupLeave(dataOffset int, ctx *handleContext) error {
 		return err
 	}
 
-	err = db.DeleteGroupMember(groupID, ctx.callbackQuery.From.ID)
+	err = db.DeleteGroupMember(groupID, ctx.callbackQuery.From.ID, ctx.callbackQuery.From.ID)
 	if err != nil {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	text := ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "youLeftGroup",
 			TemplateData: map[string]any{
 				"GroupName": group.Name,
 			},
 		},
-	))
-	bot.HandledSend(resp)
-
+	)
 	if group.OwnerID == ctx.callbackQuery.From.ID {
-		resp = tgbotapi.NewMessage(
-			ctx.callbackQuery.Message.Chat.ID,
-			ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "groupDeleted",
-				},
-			),
+		text += "\n\n" + ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "groupDeleted",
+			},
 		)
-		bot.HandledSend(resp)
+	}
+	bot.HandledSend(newCallbackEdit(ctx, text))
 
+	if group.OwnerID == ctx.callbackQuery.From.ID {
 		for _, member := range members {
 			if member.UserID == ctx.callbackQuery.From.ID {
 				continue
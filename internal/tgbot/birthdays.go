@@ -0,0 +1,369 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// BIRTHDAY_CHECK_INTERVAL is how often birthdays are checked for reminders.
+const BIRTHDAY_CHECK_INTERVAL = time.Hour
+
+// BIRTHDAY_REMINDER_DAYS is how many days before a birthday group members are reminded.
+const BIRTHDAY_REMINDER_DAYS = 7
+
+// birthdayPattern matches birthdays like "24.12", "24/12/1990" or "1990-12-24".
+var birthdayPattern = regexp.MustCompile(`^(\d{1,2})[./-](\d{1,2})(?:[./-](\d{4}))?$`)
+var isoBirthdayPattern = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+
+// upcomingBirthday is a birthday along with its next occurrence.
+type upcomingBirthday struct {
+	birthday *db.Birthday
+	date     time.Time
+	// days until the birthday, 0 if it is today.
+	days int
+}
+
+func handleBirthday(ctx *handleContext) error {
+	text := strings.TrimSpace(ctx.args.text)
+
+	if text == "" {
+		birthday, err := db.GetBirthday(ctx.user.UserID)
+		if err == sql.ErrNoRows {
+			bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "birthdayNotSet",
+				},
+			)))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "currentBirthday",
+				TemplateData: map[string]any{
+					"Date": formatBirthday(birthday.Day, birthday.Month, birthday.Year),
+				},
+			},
+		)))
+		return nil
+	}
+
+	if strings.EqualFold(text, "off") {
+		deleted, err := db.DeleteBirthday(ctx.user.UserID)
+		if err != nil {
+			return err
+		}
+		config := &i18n.LocalizeConfig{MessageID: "birthdayRemoved"}
+		if !deleted {
+			config = &i18n.LocalizeConfig{MessageID: "birthdayNotSet"}
+		}
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(config)))
+		return nil
+	}
+
+	day, month, year, ok := parseBirthday(text, time.Now())
+	if !ok {
+		return &argError{
+			messageID:    "argInvalidBirthday",
+			templateData: map[string]any{"Birthday": text},
+		}
+	}
+
+	if _, err := db.SetBirthday(ctx.user.UserID, day, month, year); err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "birthdaySet",
+			TemplateData: map[string]any{
+				"Date": formatBirthday(day, month, year),
+				"Days": BIRTHDAY_REMINDER_DAYS,
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// parseBirthday parses a birthday with an optional year, e.g. "24.12.1990".
+// Returns 0 as year if it was left out.
+func parseBirthday(text string, now time.Time) (int, int, int, bool) {
+	var day, month, year int
+	if match := birthdayPattern.FindStringSubmatch(text); match != nil {
+		day, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		year, _ = strconv.Atoi(match[3])
+	} else if match := isoBirthdayPattern.FindStringSubmatch(text); match != nil {
+		year, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		day, _ = strconv.Atoi(match[3])
+	} else {
+		return 0, 0, 0, false
+	}
+
+	if year != 0 && (year < 1900 || year > now.Year()) {
+		return 0, 0, 0, false
+	}
+
+	// without a year 29.02 must be allowed, 2000 is a leap year
+	checkYear := year
+	if checkYear == 0 {
+		checkYear = 2000
+	}
+	date := time.Date(checkYear, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day || int(date.Month()) != month {
+		return 0, 0, 0, false
+	}
+
+	return day, month, year, true
+}
+
+// formatBirthday formats a birthday, e.g. "24.12" or "24.12.1990".
+func formatBirthday(day int, month int, year int) string {
+	if year == 0 {
+		return fmt.Sprintf("%02d.%02d", day, month)
+	}
+	return fmt.Sprintf("%02d.%02d.%d", day, month, year)
+}
+
+func handleBirthdays(ctx *handleContext) error {
+	birthdays, err := db.GetGroupMatesBirthdays(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	if len(birthdays) == 0 {
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noBirthdays",
+			},
+		)))
+		return nil
+	}
+
+	today := time.Now().In(ctx.user.Location())
+	upcoming := make([]upcomingBirthday, len(birthdays))
+	for idx, birthday := range birthdays {
+		upcoming[idx] = getUpcomingBirthday(birthday, today)
+	}
+	slices.SortStableFunc(upcoming, func(a, b upcomingBirthday) int {
+		return a.days - b.days
+	})
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "birthdaysHeader",
+		},
+	)}
+	for _, entry := range upcoming {
+		name := "?"
+		if user, err := db.GetUser(entry.birthday.UserID); err == nil {
+			name = user.DisplayName()
+		}
+		lines = append(lines, renderBirthday(ctx.localizer, entry, name))
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, strings.Join(lines, "\n"))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// renderBirthday renders a line of the upcoming birthdays.
+func renderBirthday(localizer *locals.Localizer, entry upcomingBirthday, name string) string {
+	templateData := map[string]any{
+		"Date":     formatBirthday(entry.birthday.Day, entry.birthday.Month, 0),
+		"Username": name,
+		"Age":      getBirthdayAge(entry),
+		"Days":     entry.days,
+	}
+	if entry.days == 0 {
+		return localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID:    "birthdayEntryToday",
+				TemplateData: templateData,
+			},
+		)
+	}
+	return localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:    "birthdayEntry",
+			TemplateData: templateData,
+			PluralCount:  entry.days,
+		},
+	)
+}
+
+// getUpcomingBirthday returns the next occurrence of a birthday, counting today.
+// Today is the date of now in its own location, so pass now in the time zone of the user it is meant for.
+// Birthdays on 29.02 are celebrated on 28.02 in common years.
+func getUpcomingBirthday(birthday *db.Birthday, now time.Time) upcomingBirthday {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	date := birthdayInYear(birthday, today.Year())
+	if date.Before(today) {
+		date = birthdayInYear(birthday, today.Year()+1)
+	}
+
+	return upcomingBirthday{
+		birthday: birthday,
+		date:     date,
+		days:     int(date.Sub(today).Hours() / 24),
+	}
+}
+
+func birthdayInYear(birthday *db.Birthday, year int) time.Time {
+	date := time.Date(year, time.Month(birthday.Month), birthday.Day, 0, 0, 0, 0, time.UTC)
+	if int(date.Month()) != birthday.Month {
+		date = time.Date(year, time.Month(birthday.Month)+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// getBirthdayAge returns the age a member turns on an upcoming birthday, 0 if they keep it private.
+func getBirthdayAge(entry upcomingBirthday) int {
+	if entry.birthday.Year == 0 {
+		return 0
+	}
+	return entry.date.Year() - entry.birthday.Year
+}
+
+// WatchBirthdays periodically reminds group members about upcoming birthdays.
+// It blocks, so it is meant to be run in its own goroutine.
+func WatchBirthdays() {
+	for {
+		remindBirthdays(time.Now())
+		time.Sleep(BIRTHDAY_CHECK_INTERVAL)
+	}
+}
+
+// remindBirthdays reminds group members about every birthday in the next BIRTHDAY_REMINDER_DAYS days.
+// Members are reminded once per birthday.
+func remindBirthdays(now time.Time) {
+	birthdays, err := db.GetAllBirthdays()
+	if err != nil {
+		logger.Sugared.Errorw("failed to get birthdays", "err", err)
+		return
+	}
+
+	for _, birthday := range birthdays {
+		celebrant, err := db.GetUser(birthday.UserID)
+		if err != nil {
+			logger.Sugared.Errorw("failed to get user for birthday reminder", "user_id", birthday.UserID, "err", err)
+			continue
+		}
+
+		// the birthday starts at midnight where the celebrant lives
+		upcoming := getUpcomingBirthday(birthday, now.In(celebrant.Location()))
+		if upcoming.days > BIRTHDAY_REMINDER_DAYS || birthday.RemindedYear >= upcoming.date.Year() {
+			continue
+		}
+
+		firstTime, err := db.MarkBirthdayReminded(birthday.UserID, upcoming.date.Year())
+		if err != nil {
+			logger.Sugared.Errorw("failed to mark birthday reminded", "user_id", birthday.UserID, "err", err)
+			continue
+		}
+		if firstTime {
+			notifyBirthday(celebrant, upcoming)
+		}
+	}
+}
+
+// notifyBirthday reminds the members sharing a group with someone about their birthday.
+// Members of several shared groups get a single reminder with a button for each group.
+func notifyBirthday(celebrant *db.User, upcoming upcomingBirthday) {
+	groups, err := db.GetUserGroups(celebrant.UserID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get groups for birthday reminder", "user_id", celebrant.UserID, "err", err)
+		return
+	}
+
+	var memberIDs []int64
+	memberGroups := make(map[int64][]*db.Group)
+	for _, group := range groups {
+		members, err := db.GetGroupMembers(group.GroupID)
+		if err != nil {
+			logger.Sugared.Errorw("failed to get group members for birthday reminder", "group_id", group.GroupID, "err", err)
+			continue
+		}
+		for _, member := range members {
+			if member.UserID == celebrant.UserID {
+				continue
+			}
+			if _, ok := memberGroups[member.UserID]; !ok {
+				memberIDs = append(memberIDs, member.UserID)
+			}
+			memberGroups[member.UserID] = append(memberGroups[member.UserID], group)
+		}
+	}
+
+	for _, memberID := range memberIDs {
+		go func() {
+			user, err := db.GetUser(memberID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", memberID, "error", err)
+				return
+			}
+
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			templateData := map[string]any{
+				"Username": celebrant.DisplayName(),
+				"Date":     formatBirthday(upcoming.birthday.Day, upcoming.birthday.Month, 0),
+				"Age":      getBirthdayAge(upcoming),
+				"Days":     upcoming.days,
+			}
+			config := &i18n.LocalizeConfig{
+				MessageID:    "birthdayReminder",
+				TemplateData: templateData,
+				PluralCount:  upcoming.days,
+			}
+			if upcoming.days == 0 {
+				config = &i18n.LocalizeConfig{
+					MessageID:    "birthdayReminderToday",
+					TemplateData: templateData,
+				}
+			}
+
+			var rows [][]tgbotapi.InlineKeyboardButton
+			for _, group := range memberGroups[memberID] {
+				rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+					"🎁 "+group.Name,
+					fmt.Sprintf("%s%s:%d:%d", WISH_LIST_CALLBACK_PREFIX, WISH_LIST_VIEW, group.GroupID, getMemberWishesPage(group, user, celebrant.UserID)),
+				)))
+			}
+
+			msg := tgbotapi.NewMessage(user.ChatID, userLocalizer.MustLocalize(config))
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+			sendNotification(user, msg)
+		}()
+	}
+}
+
+// getMemberWishesPage returns the page of the group wish list, as seen by the viewer, the wishes of a member start on.
+func getMemberWishesPage(group *db.Group, viewer *db.User, memberID int64) int {
+	ctx := &handleContext{user: viewer, localizer: locals.GetLocalizer(viewer.Language)}
+	list, err := getViewWishList(ctx, group)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group wish list for birthday reminder", "group_id", group.GroupID, "err", err)
+		return 0
+	}
+	return list.findPage(func(item listItem) bool { return item.userID == memberID })
+}
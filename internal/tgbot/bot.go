@@ -2,11 +2,13 @@ package tgbot
 
 import (
 	"database/sql"
+	"slices"
 
 	"github.com/aybolid/wishbot/internal/db"
 	"github.com/aybolid/wishbot/internal/env"
 	"github.com/aybolid/wishbot/internal/locals"
 	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/urlnorm"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
@@ -16,24 +18,43 @@ type botAPI struct {
 }
 
 type handleContext struct {
-	user          *db.User
-	localizer     *i18n.Localizer
-	msg           *tgbotapi.Message
-	callbackQuery *tgbotapi.CallbackQuery
+	user               *db.User
+	localizer          *locals.Localizer
+	msg                *tgbotapi.Message
+	callbackQuery      *tgbotapi.CallbackQuery
+	inlineQuery        *tgbotapi.InlineQuery
+	chosenInlineResult *tgbotapi.ChosenInlineResult
+	// args are set for command handlers only.
+	args *commandArgs
+	// callbackAnswer is shown as a toast when the callback query is answered. Optional.
+	callbackAnswer string
 }
 
 // HandledSend is a wrapper around the Send method that logs sent messages and errors if any.
-func (b *botAPI) HandledSend(c tgbotapi.Chattable) {
+// The error is returned for callers that have to know whether the message got through.
+func (b *botAPI) HandledSend(c tgbotapi.Chattable) error {
 	msg, err := b.Send(c)
 	if err != nil {
 		logger.Sugared.Errorw("failed to send message", "error", err)
 	} else {
 		logger.Sugared.Infow("sent message", "text", msg.Text, "chat_id", msg.Chat.ID)
 	}
+	return err
+}
+
+// HandledRequest is a wrapper around the Request method for API calls that don't return a message.
+// It logs errors if any.
+func (b *botAPI) HandledRequest(c tgbotapi.Chattable) {
+	if _, err := b.Request(c); err != nil {
+		logger.Sugared.Errorw("failed to make request", "error", err)
+	}
 }
 
 var bot *botAPI
 
+// wishURLNormalizer canonicalizes wish urls before they are stored.
+var wishURLNormalizer = urlnorm.New(urlnorm.DefaultRules)
+
 // Init initializes the Telegram bot API.
 // It panics if an error occurs during initialization.
 func Init() {
@@ -50,6 +71,10 @@ func Init() {
 	bot.Debug = env.Vars.Mode == env.DEV_MODE
 
 	logger.Sugared.Infow("telegram bot initialized", "name", bot.Self.UserName)
+
+	wishURLNormalizer = urlnorm.New(slices.Concat(urlnorm.DefaultRules, []urlnorm.Rule{{Params: env.Vars.URLTrackingParams}}))
+
+	registerCommands()
 }
 
 // Listen starts receiving and processing incoming Telegram updates.
@@ -68,52 +93,69 @@ func processUpdate(update tgbotapi.Update) {
 	var (
 		err    error
 		chatID int64
-		userID int64
+		tgUser *tgbotapi.User
 	)
 
-	if update.Message != nil {
-		userID = update.Message.From.ID
+	switch {
+	case update.Message != nil:
+		tgUser = update.Message.From
 		chatID = update.Message.Chat.ID
-	}
-	if update.CallbackQuery != nil {
-		userID = update.CallbackQuery.From.ID
+	case update.CallbackQuery != nil:
+		tgUser = update.CallbackQuery.From
 		chatID = update.CallbackQuery.Message.Chat.ID
+	case update.InlineQuery != nil:
+		tgUser = update.InlineQuery.From
+	case update.ChosenInlineResult != nil:
+		tgUser = update.ChosenInlineResult.From
 	}
 
-	user, err := db.GetUser(userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			var tgUser *tgbotapi.User
-			if update.Message != nil {
-				tgUser = update.Message.From
-			} else if update.CallbackQuery != nil {
-				tgUser = update.CallbackQuery.From
-			}
-
-			user, err = db.CreateUser(tgUser, chatID)
-		}
+	if tgUser == nil {
+		return
+	}
+
+	user, err := db.GetUser(tgUser.ID)
+	// inline updates have no chat, so users are only created once they talk to the bot
+	if err == sql.ErrNoRows && chatID != 0 {
+		// updates may come from group chats, but the private chat id of a user is the same as the user id
+		user, err = db.CreateUser(tgUser, tgUser.ID, locals.MatchLanguage(tgUser.LanguageCode))
+	}
+	if err == nil {
+		user = refreshUserProfile(user, tgUser)
+	}
+
+	language := locals.MatchLanguage(tgUser.LanguageCode)
+	if user != nil {
+		language = user.Language
 	}
 
 	ctx := &handleContext{
-		user:          user,
-		localizer:     locals.GetLocalizer(user.Language),
-		msg:           update.Message,
-		callbackQuery: update.CallbackQuery,
+		user:               user,
+		localizer:          locals.GetLocalizer(language),
+		msg:                update.Message,
+		callbackQuery:      update.CallbackQuery,
+		inlineQuery:        update.InlineQuery,
+		chosenInlineResult: update.ChosenInlineResult,
 	}
 
-	if err == nil {
+	// unknown users can still use inline mode, they get a button to start the bot instead of results
+	if err == nil || (err == sql.ErrNoRows && chatID == 0) {
 		switch {
 		case update.Message != nil:
 			err = handleMessage(ctx)
 		case update.CallbackQuery != nil:
 			err = handleCallbackQuery(ctx)
-		default:
-			return
+		case update.InlineQuery != nil:
+			err = handleInlineQuery(ctx)
+		case update.ChosenInlineResult != nil:
+			err = handleChosenInlineResult(ctx)
 		}
 	}
 
 	if err != nil {
 		logger.Sugared.Errorw("error handling update", "error", err)
+		if chatID == 0 {
+			return
+		}
 		errResp := tgbotapi.NewMessage(chatID, ctx.localizer.MustLocalize(
 			&i18n.LocalizeConfig{
 				MessageID: "genericError",
@@ -131,8 +173,30 @@ func handleMessage(ctx *handleContext) error {
 		"from", ctx.msg.From,
 	)
 
+	if !ctx.msg.Chat.IsPrivate() {
+		return handleGroupChatMessage(ctx)
+	}
+
 	if ctx.msg.IsCommand() {
 		return handleCommand(ctx)
 	}
 	return handleText(ctx)
 }
+
+// refreshUserProfile keeps the stored username and name of a user up to date.
+// Users may change their username or name at any time, telegram doesn't notify about it.
+func refreshUserProfile(user *db.User, tgUser *tgbotapi.User) *db.User {
+	if !user.ProfileChanged(tgUser) {
+		return user
+	}
+
+	if err := db.UpdateUserProfile(tgUser); err != nil {
+		logger.Sugared.Errorw("failed to update user profile", "user_id", tgUser.ID, "err", err)
+		return user
+	}
+
+	user.Username = tgUser.UserName
+	user.FirstName = tgUser.FirstName
+	user.LastName = tgUser.LastName
+	return user
+}
@@ -0,0 +1,384 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// PURCHASE_CALLBACK_PREFIX is followed by the wish id, e.g. "purchase:1".
+const PURCHASE_CALLBACK_PREFIX = "purchase:"
+
+// budgetEntry is the budget and the spending of a user in a group for an occasion.
+type budgetEntry struct {
+	groupID  int64
+	occasion string
+	// budget is nil if the user only recorded purchases.
+	budget *db.Budget
+	// spent sums purchases per currency, amounts in different currencies are never added up.
+	spent map[string]int64
+	// currencies keeps the order currencies were first spent in.
+	currencies []string
+}
+
+func handleBudget(ctx *handleContext) error {
+	if ctx.args.text == "" {
+		return sendBudgetSummary(ctx, ctx.args.group)
+	}
+
+	group := ctx.args.group
+	if group == nil {
+		groups, err := db.GetUserGroups(ctx.user.UserID)
+		if err != nil {
+			return err
+		}
+		switch len(groups) {
+		case 0:
+			resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "noGroups",
+				},
+			))
+			bot.HandledSend(resp)
+			return nil
+		case 1:
+			group = groups[0]
+		default:
+			return &argError{
+				messageID:    "argMissing",
+				templateData: map[string]any{"Arg": localizeArgName(ctx, optionalGroupArg)},
+			}
+		}
+	}
+
+	amount, occasion, err := money.ParsePrefix(ctx.args.text, "")
+	if err != nil {
+		return &argError{
+			messageID:    "argInvalidAmount",
+			templateData: map[string]any{"Amount": ctx.args.text},
+		}
+	}
+
+	templateData := map[string]any{
+		"GroupName": group.Name,
+		"Occasion":  occasion,
+		"Amount":    amount.String(),
+	}
+
+	// a zero budget removes the budget
+	if amount.Value == 0 {
+		deleted, err := db.DeleteBudget(ctx.user.UserID, group.GroupID, occasion)
+		if err != nil {
+			return err
+		}
+		config := &i18n.LocalizeConfig{MessageID: "budgetRemoved", TemplateData: templateData}
+		if !deleted {
+			config = &i18n.LocalizeConfig{MessageID: "budgetNotFound", TemplateData: templateData}
+		}
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(config)))
+		return nil
+	}
+
+	budget, err := db.SetBudget(ctx.user.UserID, group.GroupID, occasion, amount)
+	if err != nil {
+		return err
+	}
+	// the stored spelling of an existing occasion wins
+	templateData["Occasion"] = budget.Occasion
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:    "budgetSet",
+			TemplateData: templateData,
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// sendBudgetSummary sends the budgets and spending of the user, in all groups unless a group is given.
+func sendBudgetSummary(ctx *handleContext, group *db.Group) error {
+	groups := []*db.Group{group}
+	if group == nil {
+		var err error
+		groups, err = db.GetUserGroups(ctx.user.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := getBudgetEntries(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	var sections []string
+	for _, group := range groups {
+		for _, entry := range entries {
+			if entry.groupID != group.GroupID {
+				continue
+			}
+			lines := []string{ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "budgetSection",
+					TemplateData: map[string]any{
+						"GroupName": group.Name,
+						"Occasion":  entry.occasion,
+					},
+				},
+			)}
+			lines = append(lines, renderBudgetEntry(ctx.localizer, entry)...)
+			sections = append(sections, strings.Join(lines, "\n"))
+		}
+	}
+
+	if len(sections) == 0 {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noBudgets",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	header := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "budgetHeader",
+		},
+	)
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, header+"\n\n"+strings.Join(sections, "\n\n"))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// getBudgetEntries collects the budgets and purchases of a user by group and occasion.
+// Entries with a budget come first, the group-wide budget before the occasions.
+func getBudgetEntries(userID int64) ([]*budgetEntry, error) {
+	budgets, err := db.GetUserBudgets(userID)
+	if err != nil {
+		return nil, err
+	}
+	purchases, err := db.GetUserPurchases(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*budgetEntry
+	// occasions are matched case insensitively, like in the database
+	findEntry := func(groupID int64, occasion string) *budgetEntry {
+		for _, entry := range entries {
+			if entry.groupID == groupID && strings.EqualFold(entry.occasion, occasion) {
+				return entry
+			}
+		}
+		entry := &budgetEntry{groupID: groupID, occasion: occasion, spent: make(map[string]int64)}
+		entries = append(entries, entry)
+		return entry
+	}
+
+	for _, budget := range budgets {
+		findEntry(budget.GroupID, budget.Occasion).budget = budget
+	}
+	for _, purchase := range purchases {
+		entry := findEntry(purchase.GroupID, purchase.Occasion)
+		if _, ok := entry.spent[purchase.Amount.Currency]; !ok {
+			entry.currencies = append(entry.currencies, purchase.Amount.Currency)
+		}
+		entry.spent[purchase.Amount.Currency] += purchase.Amount.Value
+	}
+
+	return entries, nil
+}
+
+// renderBudgetEntry renders the remaining budget and the spending of an entry.
+// Purchases in other currencies than the budget are listed separately instead of being converted.
+func renderBudgetEntry(localizer *locals.Localizer, entry *budgetEntry) []string {
+	var lines []string
+	currencies := entry.currencies
+
+	if entry.budget != nil {
+		budget := entry.budget.Amount
+		spent := money.Amount{Value: entry.spent[budget.Currency], Currency: budget.Currency}
+		left := money.Amount{Value: budget.Value - spent.Value, Currency: budget.Currency}
+
+		config := &i18n.LocalizeConfig{
+			MessageID: "budgetLeft",
+			TemplateData: map[string]any{
+				"Budget": budget.String(),
+				"Spent":  spent.String(),
+				"Left":   left.String(),
+			},
+		}
+		if left.Value < 0 {
+			config = &i18n.LocalizeConfig{
+				MessageID: "budgetOver",
+				TemplateData: map[string]any{
+					"Budget": budget.String(),
+					"Spent":  spent.String(),
+					"Over":   money.Amount{Value: -left.Value, Currency: budget.Currency}.String(),
+				},
+			}
+		}
+		lines = append(lines, localizer.MustLocalize(config))
+
+		currencies = slices.DeleteFunc(slices.Clone(currencies), func(currency string) bool {
+			return currency == budget.Currency
+		})
+	}
+
+	if len(currencies) == 0 {
+		return lines
+	}
+
+	amounts := make([]string, len(currencies))
+	for idx, currency := range currencies {
+		amounts[idx] = money.Amount{Value: entry.spent[currency], Currency: currency}.String()
+	}
+
+	config := &i18n.LocalizeConfig{
+		MessageID:    "budgetSpent",
+		TemplateData: map[string]any{"Amounts": strings.Join(amounts, ", ")},
+	}
+	if entry.budget != nil {
+		config = &i18n.LocalizeConfig{
+			MessageID:    "budgetOtherCurrencies",
+			TemplateData: map[string]any{"Amounts": strings.Join(amounts, ", ")},
+		}
+	}
+
+	return append(lines, localizer.MustLocalize(config))
+}
+
+func handlePurchaseCallback(ctx *handleContext) error {
+	wishID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(PURCHASE_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, ok, err := getGiftWish(ctx, wishID)
+	if err != nil || !ok {
+		return err
+	}
+
+	State.setPendingPurchase(ctx.callbackQuery.From.ID, wishID)
+
+	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "purchaseSendAmount",
+			TemplateData: map[string]any{
+				"WishURL": html.EscapeString(wish.URL),
+			},
+		},
+	))
+	resp.ParseMode = tgbotapi.ModeHTML
+	resp.DisableWebPagePreview = true
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handlePurchaseFlow(ctx *handleContext) error {
+	wishID, ok := getPendingPurchase(ctx.msg.From.ID)
+	if !ok {
+		State.releaseUser(ctx.msg.From.ID)
+		return fmt.Errorf("user is not pending purchase")
+	}
+
+	wish, err := db.GetWish(wishID)
+	if err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	entries, err := getBudgetEntries(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+	var budgets []*db.Budget
+	for _, entry := range entries {
+		if entry.groupID == wish.GroupID && entry.budget != nil {
+			budgets = append(budgets, entry.budget)
+		}
+	}
+
+	// with a single budget in the group, its currency and occasion are implied
+	defaultCurrency := ""
+	if len(budgets) == 1 {
+		defaultCurrency = budgets[0].Amount.Currency
+	}
+
+	amount, occasion, err := money.ParsePrefix(ctx.msg.Text, defaultCurrency)
+	if err != nil || amount.Value == 0 {
+		logger.Sugared.Debugw("invalid purchase amount", "text", ctx.msg.Text, "err", err)
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "purchaseInvalidAmount",
+			},
+		))
+		resp.ParseMode = tgbotapi.ModeHTML
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	if occasion == "" && len(budgets) == 1 {
+		occasion = budgets[0].Occasion
+	}
+
+	_, err = db.CreatePurchase(ctx.user.UserID, wishID, occasion, amount)
+	if err == sql.ErrNoRows {
+		// the wish was deleted while the user was typing
+		State.releaseUser(ctx.msg.From.ID)
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishNotFound",
+			},
+		)))
+		return nil
+	}
+	if err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	State.releaseUser(ctx.msg.From.ID)
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "purchaseRecorded",
+			TemplateData: map[string]any{
+				"Amount":  amount.String(),
+				"WishURL": wish.URL,
+			},
+		},
+	)}
+
+	// show what is left of the budget the purchase counts against
+	entries, err = getBudgetEntries(ctx.user.UserID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get budgets after purchase", "user_id", ctx.user.UserID, "err", err)
+	}
+	for _, entry := range entries {
+		if entry.groupID == wish.GroupID && strings.EqualFold(entry.occasion, occasion) && entry.budget != nil {
+			lines = append(lines, renderBudgetEntry(ctx.localizer, entry)...)
+		}
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, strings.Join(lines, "\n"))
+	resp.DisableWebPagePreview = true
+	bot.HandledSend(resp)
+
+	return nil
+}
@@ -2,6 +2,7 @@ package tgbot
 
 import (
 	"fmt"
+	"html"
 	"strconv"
 	"strings"
 
@@ -26,20 +27,36 @@ var callbackHandlers = map[string]callbackHandler{
 	MANAGE_WISHES_CALLBACK_PREFIX:    handleManageWishesCallback,
 	MANAGE_MEMBERS_CALLBACK_PREFIX:   handleManageMembersCallback,
 	KICK_MEMBER_CALLBACK_PREFIX:      handleKickMemberCallback,
+	POOL_CALLBACK_PREFIX:             handlePoolCallback,
+	BIND_CHAT_CALLBACK_PREFIX:        handleBindChatCallback,
+	SET_LANGUAGE_CALLBACK_PREFIX:     handleSetLanguageCallback,
+	HISTORY_CALLBACK_PREFIX:          handleHistoryCallback,
+	WISH_LIST_CALLBACK_PREFIX:        handleWishListCallback,
+	SEARCH_CALLBACK_PREFIX:           handleSearchCallback,
+	UPDATE_WISH_URL_CALLBACK_PREFIX:  handleUpdateWishURLCallback,
+	WISH_MENU_CALLBACK_PREFIX:        handleWishMenuCallback,
+	MOVE_WISH_CALLBACK_PREFIX:        handleMoveWishCallback,
+	GIFT_MENU_CALLBACK_PREFIX:        handleGiftMenuCallback,
+	PURCHASE_CALLBACK_PREFIX:         handlePurchaseCallback,
+	NOTIFICATIONS_CALLBACK_PREFIX:    handleNotificationsCallback,
+	IDEAS_CALLBACK_PREFIX:            handleIdeasCallback,
+	COPY_WISH_CALLBACK_PREFIX:        handleCopyWishCallback,
+	TEMPLATE_CALLBACK_PREFIX:         handleTemplateCallback,
+	PROFILE_CALLBACK_PREFIX:          handleProfileCallback,
 }
 
 func handleCallbackQuery(ctx *handleContext) error {
-	defer func() {
-		deleteReq := tgbotapi.NewDeleteMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID)
-		bot.HandledSend(deleteReq)
-	}()
-
 	logger.Sugared.Infow("handling callback query", "data", ctx.callbackQuery.Data)
 
 	delimIndex := strings.IndexByte(ctx.callbackQuery.Data, ':')
 	prefix := ctx.callbackQuery.Data[0 : delimIndex+1]
 	logger.Sugared.Debugw("callback query prefix extracted", "prefix", prefix)
 
+	// every query is answered, otherwise the button keeps loading
+	defer func() {
+		bot.HandledRequest(tgbotapi.NewCallback(ctx.callbackQuery.ID, ctx.callbackAnswer))
+	}()
+
 	handler, ok := callbackHandlers[prefix]
 	if ok {
 		return handler(ctx)
@@ -49,6 +66,12 @@ func handleCallbackQuery(ctx *handleContext) error {
 	return nil
 }
 
+// newCallbackEdit replaces the text of the message the callback query came from.
+// The inline keyboard of the message is removed unless a new one is set.
+func newCallbackEdit(ctx *handleContext, text string) tgbotapi.EditMessageTextConfig {
+	return tgbotapi.NewEditMessageText(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, text)
+}
+
 func handleKickMemberCallback(ctx *handleContext) error {
 	payload := strings.Split(ctx.callbackQuery.Data[len(KICK_MEMBER_CALLBACK_PREFIX):], ":")
 	logger.Sugared.Debugw("kick member payload", "payload", payload)
@@ -83,13 +106,14 @@ func handleKickMemberCallback(ctx *handleContext) error {
 				&i18n.LocalizeConfig{
 					MessageID: "kickMember",
 					TemplateData: map[string]any{
-						"Username":  user.Username,
+						"Username":  html.EscapeString(user.DisplayName()),
 						"GroupName": group.Name,
 					},
 				},
 			),
 			actionID:     KICK_MEMBER_ACTION,
 			callbackData: fmt.Sprintf("%d:%d", user.UserID, groupID),
+			messageID:    ctx.callbackQuery.Message.MessageID,
 		},
 	)
 
@@ -110,15 +134,14 @@ func handleManageMembersCallback(ctx *handleContext) error {
 	}
 	if group.OwnerID != ctx.callbackQuery.From.ID {
 		logger.Sugared.Errorw("not the owner of the group", "group_id", groupID, "owner_id", group.OwnerID, "user_id", ctx.callbackQuery.From.ID)
-		resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
 			&i18n.LocalizeConfig{
 				MessageID: "notOwner",
 				TemplateData: map[string]any{
 					"GroupName": group.Name,
 				},
 			},
-		))
-		bot.HandledSend(resp)
+		)
 		return nil
 	}
 
@@ -136,7 +159,7 @@ func handleManageMembersCallback(ctx *handleContext) error {
 	}
 
 	if len(filteredMembers) == 0 {
-		resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+		edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 			&i18n.LocalizeConfig{
 				MessageID: "noMembers",
 				TemplateData: map[string]any{
@@ -144,22 +167,19 @@ func handleManageMembersCallback(ctx *handleContext) error {
 				},
 			},
 		))
-		bot.HandledSend(resp)
+		bot.HandledSend(edit)
 		return nil
 	}
 
-	resp := tgbotapi.NewMessage(
-		ctx.callbackQuery.Message.Chat.ID,
-		ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "hereAreMembers",
-				TemplateData: map[string]any{
-					"GroupName": group.Name,
-				},
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "hereAreMembers",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
 			},
-		),
-	)
-	bot.HandledSend(resp)
+		},
+	))
+	bot.HandledSend(edit)
 
 	for _, member := range filteredMembers {
 		go func() {
@@ -175,14 +195,21 @@ func handleManageMembersCallback(ctx *handleContext) error {
 				return
 			}
 
-			msg := tgbotapi.NewMessage(
-				ctx.callbackQuery.Message.Chat.ID,
-				fmt.Sprintf(
-					"@%s\nThey have %d wishes.",
-					user.Username,
-					len(userWishes),
-				),
+			text := ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID:   "memberDisplay",
+					PluralCount: len(userWishes),
+					TemplateData: map[string]any{
+						"Username":  user.DisplayName(),
+						"WishCount": len(userWishes),
+					},
+				},
 			)
+			if profile := getProfileText(ctx.localizer, member.UserID); profile != "" {
+				text += "\n\n" + profile
+			}
+
+			msg := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, text)
 
 			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 				tgbotapi.NewInlineKeyboardRow(
@@ -211,66 +238,8 @@ func handleManageWishesCallback(ctx *handleContext) error {
 	if err != nil {
 		return err
 	}
-	wishes, err := db.GetUserWishes(ctx.callbackQuery.From.ID, groupID)
-	if err != nil {
-		return err
-	}
 
-	if len(wishes) == 0 {
-		resp := tgbotapi.NewMessage(
-			ctx.callbackQuery.Message.Chat.ID,
-			ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "noWishes",
-					TemplateData: map[string]any{
-						"GroupName": group.Name,
-					},
-				},
-			),
-		)
-		bot.HandledSend(resp)
-		return nil
-	}
-
-	resp := tgbotapi.NewMessage(
-		ctx.callbackQuery.Message.Chat.ID,
-		ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "hereAreYourWishes",
-				TemplateData: map[string]any{
-					"GroupName": group.Name,
-				},
-			},
-		),
-	)
-	bot.HandledSend(resp)
-
-	for _, wish := range wishes {
-		go func() {
-			msg := tgbotapi.NewMessage(
-				ctx.callbackQuery.Message.Chat.ID,
-				fmt.Sprintf(
-					"%s\n%s\n\n",
-					wish.URL,
-					wish.Description,
-				),
-			)
-
-			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(ctx.localizer.MustLocalize(
-						&i18n.LocalizeConfig{
-							MessageID: "delete",
-						},
-					), fmt.Sprintf("%s%d", DELETE_WISH_CALLBACK_PREFIX, wish.WishID)),
-				),
-			)
-
-			bot.HandledSend(msg)
-		}()
-	}
-
-	return nil
+	return sendWishList(ctx, ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, group, WISH_LIST_MANAGE, 0)
 }
 
 func handleDeleteWishCallback(ctx *handleContext) error {
@@ -303,6 +272,7 @@ func handleDeleteWishCallback(ctx *handleContext) error {
 		),
 		actionID:     DELETE_WISH_ACTION,
 		callbackData: fmt.Sprintf("%d", wish.WishID),
+		messageID:    ctx.callbackQuery.Message.MessageID,
 	})
 
 	return err
@@ -346,6 +316,7 @@ func handleLeaveGroupCallback(ctx *handleContext) error {
 		message:      message,
 		actionID:     LEAVE_GROUP_ACTION,
 		callbackData: fmt.Sprintf("%d", group.GroupID),
+		messageID:    ctx.callbackQuery.Message.MessageID,
 	})
 
 	return err
@@ -365,7 +336,7 @@ func handleInviteMemberCallback(ctx *handleContext) error {
 
 	State.setPendingInviteCreation(userID, groupID)
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "mentionToInvite",
 			TemplateData: map[string]any{
@@ -373,7 +344,7 @@ func handleInviteMemberCallback(ctx *handleContext) error {
 			},
 		},
 	))
-	bot.HandledSend(resp)
+	bot.HandledSend(edit)
 
 	return nil
 }
@@ -392,12 +363,12 @@ func handleRejectInviteCallback(ctx *handleContext) error {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "youRejectedInvite",
 		},
 	))
-	bot.HandledSend(resp)
+	bot.HandledSend(edit)
 
 	msg := tgbotapi.NewMessage(
 		inviter.ChatID,
@@ -435,12 +406,12 @@ func handleAcceptInviteCallback(ctx *handleContext) error {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "youAcceptedInvite",
 		},
 	))
-	bot.HandledSend(resp)
+	bot.HandledSend(edit)
 
 	msg := tgbotapi.NewMessage(
 		inviter.ChatID,
@@ -470,31 +441,17 @@ func handleAddWishCallback(ctx *handleContext) error {
 		return err
 	}
 
-	resp := tgbotapi.NewMessage(
-		ctx.callbackQuery.Message.Chat.ID,
-		ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "letsAddWish",
-				TemplateData: map[string]any{
-					"GroupName": group.Name,
-				},
-			},
-		),
-	)
-	bot.HandledSend(resp)
-
-	resp = tgbotapi.NewMessage(
-		ctx.callbackQuery.Message.Chat.ID,
-		ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "sendWishData",
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "letsAddWish",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
 			},
-		),
-	)
-	resp.ParseMode = tgbotapi.ModeMarkdownV2
-	bot.HandledSend(resp)
+		},
+	))
+	bot.HandledSend(edit)
 
-	State.setPendingWishCreation(ctx.callbackQuery.From.ID, groupID)
+	sendWishDataPrompt(ctx, ctx.callbackQuery.Message.Chat.ID, groupID)
 
 	return nil
 }
@@ -510,86 +467,5 @@ func handleDisplayWishesCallback(ctx *handleContext) error {
 		return err
 	}
 
-	wishes, err := db.GetGroupWishes(group.GroupID)
-	if err != nil {
-		return err
-	}
-
-	if len(wishes) == 0 {
-		resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "noWishes",
-				TemplateData: map[string]any{
-					"GroupName": group.Name,
-				},
-			},
-		))
-		bot.HandledSend(resp)
-		return nil
-	}
-
-	var groupedByUser = make(map[int64][]*db.Wish)
-	for _, wish := range wishes {
-		groupedByUser[wish.UserID] = append(groupedByUser[wish.UserID], wish)
-	}
-
-	resp := tgbotapi.NewMessage(
-		ctx.callbackQuery.Message.Chat.ID,
-		ctx.localizer.MustLocalize(
-			&i18n.LocalizeConfig{
-				MessageID: "hereAreWishes",
-				TemplateData: map[string]any{
-					"GroupName": group.Name,
-				},
-			},
-		),
-	)
-	bot.HandledSend(resp)
-
-	for user, wishes := range groupedByUser {
-		go func() {
-			user, err := db.GetUser(user)
-			if err != nil {
-				logger.Sugared.Errorw("failed to get user for wishes display", "user_id", user, "err", err)
-				return
-			}
-
-			text := ""
-
-			if user.UserID == ctx.callbackQuery.From.ID {
-				text += ctx.localizer.MustLocalize(
-					&i18n.LocalizeConfig{
-						MessageID: "yourWishes",
-					},
-				)
-			} else {
-				text += ctx.localizer.MustLocalize(
-					&i18n.LocalizeConfig{
-						MessageID: "userWishes",
-						TemplateData: map[string]any{
-							"Username": user.Username,
-						},
-					},
-				)
-			}
-			text += "\n\n"
-
-			for idx, wish := range wishes {
-				text += fmt.Sprintf(
-					"%d. %s\n%s\n\n",
-					idx+1,
-					wish.URL,
-					wish.Description,
-				)
-			}
-
-			resp := tgbotapi.NewMessage(
-				ctx.callbackQuery.Message.Chat.ID,
-				text,
-			)
-			bot.HandledSend(resp)
-		}()
-	}
-
-	return nil
+	return sendWishList(ctx, ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, group, WISH_LIST_VIEW, 0)
 }
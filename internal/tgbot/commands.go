@@ -2,10 +2,12 @@ package tgbot
 
 import (
 	"fmt"
+	"html"
+	"slices"
 	"strings"
 
 	"github.com/aybolid/wishbot/internal/db"
-	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/env"
 	"github.com/aybolid/wishbot/internal/logger"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -13,72 +15,192 @@ import (
 
 type cmdHandler func(ctx *handleContext) error
 
-var cmdHandlers = map[string]cmdHandler{
-	"/start": handleStart,
+var optionalGroupArg = argSpec{kind: GROUP_ARG, optional: true, nameMessageID: "argGroup"}
+
+// privateCommands are the commands available in private chats.
+// Passing a group as an argument skips the group selection menu.
+// The registry is filled in init, since /help renders the registry itself.
+var privateCommands []*command
+
+func init() {
+	privateCommands = []*command{
+		{
+			name:    "start",
+			handler: handleStart,
+			// deep link parameter, e.g. "/start inline"
+			args:   []argSpec{{kind: TEXT_ARG, optional: true, nameMessageID: "argStartPayload"}},
+			hidden: true,
+		},
+		{name: "help", handler: handleHelp, descriptionMessageID: "commandHelp"},
+
+		{
+			name:                 "creategroup",
+			handler:              handleCreateGroup,
+			args:                 []argSpec{{kind: TEXT_ARG, optional: true, nameMessageID: "argGroupName"}},
+			descriptionMessageID: "commandCreateGroup",
+		},
+		{
+			name:                 "leavegroup",
+			handler:              handleLeaveGroup,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandLeaveGroup",
+		},
+		{name: "mygroups", handler: handleMyGroups, descriptionMessageID: "commandMyGroups"},
+
+		{
+			name:    "addmember",
+			handler: handleAddMember,
+			args: []argSpec{
+				optionalGroupArg,
+				{kind: USERNAMES_ARG, optional: true, nameMessageID: "argUsernames"},
+			},
+			descriptionMessageID: "commandAddMember",
+		},
+		{
+			name:                 "managemembers",
+			handler:              handleManageMembers,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandManageMembers",
+		},
+
+		{
+			name:    "addwish",
+			handler: handleAddWish,
+			args: []argSpec{
+				optionalGroupArg,
+				{kind: URL_ARG, optional: true, nameMessageID: "argURL"},
+				{kind: TEXT_ARG, optional: true, nameMessageID: "argDescription"},
+			},
+			descriptionMessageID: "commandAddWish",
+		},
+		{
+			name:                 "wishes",
+			handler:              handleWishes,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandWishes",
+		},
+		{
+			name:                 "managewishes",
+			handler:              handleManageWishes,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandManageWishes",
+		},
+		{
+			name:                 "search",
+			handler:              handleSearch,
+			args:                 []argSpec{{kind: TEXT_ARG, nameMessageID: "argSearchQuery"}},
+			descriptionMessageID: "commandSearch",
+		},
+
+		{
+			name:    "budget",
+			handler: handleBudget,
+			args: []argSpec{
+				optionalGroupArg,
+				{kind: TEXT_ARG, optional: true, nameMessageID: "argBudget"},
+			},
+			descriptionMessageID: "commandBudget",
+		},
+
+		{name: "cancel", handler: handleCancel, descriptionMessageID: "commandCancel"},
 
-	"/creategroup": handleCreateGroup,
-	"/leavegroup":  handleLeaveGroup,
-	"/mygroups":    handleMyGroups,
+		{name: "language", handler: handleLanguage, descriptionMessageID: "commandLanguage"},
 
-	"/addmember":     handleAddMember,
-	"/managemembers": handleManageMembers,
+		{
+			name:                 "history",
+			handler:              handleHistory,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandHistory",
+		},
 
-	"/addwish":      handleAddWish,
-	"/wishes":       handleWishes,
-	"/managewishes": handleManageWishes,
+		{
+			name:                 "notifications",
+			handler:              handleNotifications,
+			args:                 []argSpec{optionalGroupArg},
+			descriptionMessageID: "commandNotifications",
+		},
+		{name: "templates", handler: handleTemplates, descriptionMessageID: "commandTemplates"},
+		{name: "profile", handler: handleProfile, descriptionMessageID: "commandProfile"},
+
+		{
+			name:                 "birthday",
+			handler:              handleBirthday,
+			args:                 []argSpec{{kind: TEXT_ARG, optional: true, nameMessageID: "argBirthday"}},
+			descriptionMessageID: "commandBirthday",
+		},
+		{name: "birthdays", handler: handleBirthdays, descriptionMessageID: "commandBirthdays"},
 
-	"/cancel": handleCancel,
+		{
+			name:                 "timezone",
+			handler:              handleTimezone,
+			args:                 []argSpec{{kind: TEXT_ARG, optional: true, nameMessageID: "argTimezone"}},
+			descriptionMessageID: "commandTimezone",
+		},
+		{
+			name:                 "quiet",
+			handler:              handleQuiet,
+			args:                 []argSpec{{kind: TEXT_ARG, optional: true, nameMessageID: "argQuietHours"}},
+			descriptionMessageID: "commandQuiet",
+		},
 
-	"/togglelanguage": handleToggleLanguage,
+		{name: "mydata", handler: handleMyData, descriptionMessageID: "commandMyData"},
+		{name: "forgetme", handler: handleForgetMe, descriptionMessageID: "commandForgetMe"},
+	}
 }
 
 func handleCommand(ctx *handleContext) error {
 	logger.Sugared.Infow("handling command", "command", ctx.msg.Text, "chat_id", ctx.msg.Chat.ID, "from", ctx.msg.From)
 	State.releaseUser(ctx.msg.From.ID)
 
-	var err error
+	return routeCommand(ctx, getPrivateCommands(ctx.user.UserID))
+}
 
-	if handler, ok := cmdHandlers[ctx.msg.Text]; ok {
-		err = handler(ctx)
-	} else {
-		logger.Sugared.Errorw("unknown command received", "command", ctx.msg.Text, "chat_id", ctx.msg.Chat.ID, "from", ctx.msg.From)
+// getPrivateCommands returns the commands available to a user in private chats.
+func getPrivateCommands(userID int64) []*command {
+	if env.Vars.IsAdmin(userID) {
+		return slices.Concat(privateCommands, adminCommands)
 	}
-
-	return err
+	return privateCommands
 }
 
-const MANAGE_MEMBERS_CALLBACK_PREFIX = "managemembers:"
-
-func handleToggleLanguage(ctx *handleContext) error {
-	newLanguage := "en"
-	if ctx.user.Language == locals.ENGLISH {
-		newLanguage = locals.UKRAINIAN
+// narrowToArgGroup narrows groups down to the group passed as a command argument, if any.
+// If mustOwn is set and the user doesn't own the passed group, a reply is sent and false is returned.
+func narrowToArgGroup(ctx *handleContext, groups []*db.Group, mustOwn bool) ([]*db.Group, bool) {
+	if ctx.args == nil || ctx.args.group == nil {
+		return groups, true
 	}
 
-	err := db.UpdateLanguage(ctx.user.UserID, newLanguage)
-	if err != nil {
-		return err
+	group := ctx.args.group
+	if mustOwn && group.OwnerID != ctx.msg.From.ID {
+		logger.Sugared.Errorw("not the owner of the group", "group_id", group.GroupID, "owner_id", group.OwnerID, "user_id", ctx.msg.From.ID)
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notOwner",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil, false
 	}
 
-	newLocalizer := locals.GetLocalizer(newLanguage)
-
-	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, newLocalizer.MustLocalize(
-		&i18n.LocalizeConfig{
-			MessageID: "languageToggled",
-		},
-	))
-
-	bot.HandledSend(resp)
-
-	return nil
+	return []*db.Group{group}, true
 }
 
+const MANAGE_MEMBERS_CALLBACK_PREFIX = "managemembers:"
+
 func handleManageMembers(ctx *handleContext) error {
 	groups, err := db.GetOwnedGroups(ctx.msg.From.ID)
 	if err != nil {
 		return err
 	}
 
+	groups, ok := narrowToArgGroup(ctx, groups, true)
+	if !ok {
+		return nil
+	}
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -162,18 +284,21 @@ func handleManageMembers(ctx *handleContext) error {
 					return
 				}
 
-				msg := tgbotapi.NewMessage(
-					ctx.msg.Chat.ID,
-					ctx.localizer.MustLocalize(
-						&i18n.LocalizeConfig{
-							MessageID: "memberDisplay",
-							TemplateData: map[string]any{
-								"Username":  user.Username,
-								"WishCount": len(userWishes),
-							},
+				text := ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID:   "memberDisplay",
+						PluralCount: len(userWishes),
+						TemplateData: map[string]any{
+							"Username":  user.DisplayName(),
+							"WishCount": len(userWishes),
 						},
-					),
+					},
 				)
+				if profile := getProfileText(ctx.localizer, member.UserID); profile != "" {
+					text += "\n\n" + profile
+				}
+
+				msg := tgbotapi.NewMessage(ctx.msg.Chat.ID, text)
 
 				msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 					tgbotapi.NewInlineKeyboardRow(
@@ -221,6 +346,8 @@ func handleManageWishes(ctx *handleContext) error {
 		return err
 	}
 
+	groups, _ = narrowToArgGroup(ctx, groups, false)
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -232,67 +359,7 @@ func handleManageWishes(ctx *handleContext) error {
 		return nil
 
 	case 1:
-		group := groups[0]
-
-		wishes, err := db.GetGroupWishes(group.GroupID)
-		if err != nil {
-			return err
-		}
-
-		if len(wishes) == 0 {
-			resp := tgbotapi.NewMessage(
-				ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
-					&i18n.LocalizeConfig{
-						MessageID: "noWishes",
-						TemplateData: map[string]string{
-							"GroupName": group.Name,
-						},
-					},
-				),
-			)
-			bot.HandledSend(resp)
-			return nil
-		}
-
-		resp := tgbotapi.NewMessage(
-			ctx.msg.Chat.ID,
-			ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "hereAreYourWishes",
-					TemplateData: map[string]string{
-						"GroupName": group.Name,
-					},
-				},
-			),
-		)
-		bot.HandledSend(resp)
-
-		for _, wish := range wishes {
-			go func() {
-				msg := tgbotapi.NewMessage(
-					ctx.msg.Chat.ID,
-					fmt.Sprintf(
-						"%s\n%s\n\n",
-						wish.URL,
-						wish.Description,
-					),
-				)
-
-				msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-					tgbotapi.NewInlineKeyboardRow(
-						tgbotapi.NewInlineKeyboardButtonData(ctx.localizer.MustLocalize(
-							&i18n.LocalizeConfig{
-								MessageID: "delete",
-							},
-						), fmt.Sprintf("%s%d", DELETE_WISH_CALLBACK_PREFIX, wish.WishID)),
-					),
-				)
-
-				bot.HandledSend(msg)
-			}()
-		}
-
-		return nil
+		return sendWishList(ctx, ctx.msg.Chat.ID, 0, groups[0], WISH_LIST_MANAGE, 0)
 
 	default:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -320,6 +387,8 @@ func handleLeaveGroup(ctx *handleContext) error {
 		return err
 	}
 
+	groups, _ = narrowToArgGroup(ctx, groups, false)
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -410,6 +479,10 @@ func handleStart(ctx *handleContext) error {
 }
 
 func handleCreateGroup(ctx *handleContext) error {
+	if ctx.args.text != "" {
+		return createGroup(ctx, ctx.args.text)
+	}
+
 	userID := ctx.msg.From.ID
 	State.setPendingGroupCreation(userID)
 
@@ -466,7 +539,7 @@ func handleMyGroups(ctx *handleContext) error {
 
 				usernames := make([]string, len(users))
 				for idx, user := range users {
-					usernames[idx] = "@" + user.Username
+					usernames[idx] = html.EscapeString(user.DisplayName())
 					if user.UserID == group.OwnerID {
 						usernames[idx] += " (⭐)"
 					}
@@ -476,7 +549,8 @@ func handleMyGroups(ctx *handleContext) error {
 					ctx.msg.Chat.ID,
 					ctx.localizer.MustLocalize(
 						&i18n.LocalizeConfig{
-							MessageID: "groupEntry",
+							MessageID:   "groupEntry",
+							PluralCount: len(users),
 							TemplateData: map[string]any{
 								"GroupName":   group.Name,
 								"MemberCount": len(users),
@@ -501,6 +575,26 @@ func handleAddMember(ctx *handleContext) error {
 		return err
 	}
 
+	groups, ok := narrowToArgGroup(ctx, groups, true)
+	if !ok {
+		return nil
+	}
+
+	if len(ctx.args.usernames) > 0 {
+		switch len(groups) {
+		case 0:
+		case 1:
+			// mentions in the command message are handled like a reply to the invite prompt
+			State.setPendingInviteCreation(ctx.msg.From.ID, groups[0].GroupID)
+			return handleCreatingInviteFlow(ctx)
+		default:
+			return &argError{
+				messageID:    "argMissing",
+				templateData: map[string]any{"Arg": localizeArgName(ctx, optionalGroupArg)},
+			}
+		}
+	}
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -554,6 +648,29 @@ func handleAddWish(ctx *handleContext) error {
 		return err
 	}
 
+	groups, _ = narrowToArgGroup(ctx, groups, false)
+
+	if ctx.args.text != "" && ctx.args.url == "" {
+		token, _ := nextToken(ctx.args.text)
+		return &argError{
+			messageID:    "argInvalidURL",
+			templateData: map[string]any{"URL": token},
+		}
+	}
+
+	if ctx.args.url != "" {
+		switch len(groups) {
+		case 0:
+		case 1:
+			return createWish(ctx, groups[0].GroupID, ctx.args.url, ctx.args.text)
+		default:
+			return &argError{
+				messageID:    "argMissing",
+				templateData: map[string]any{"Arg": localizeArgName(ctx, optionalGroupArg)},
+			}
+		}
+	}
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -580,18 +697,7 @@ func handleAddWish(ctx *handleContext) error {
 		)
 		bot.HandledSend(resp)
 
-		resp = tgbotapi.NewMessage(
-			ctx.msg.Chat.ID,
-			ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "sendWishData",
-				},
-			),
-		)
-		resp.ParseMode = tgbotapi.ModeMarkdownV2
-		bot.HandledSend(resp)
-
-		State.setPendingWishCreation(ctx.msg.From.ID, group.GroupID)
+		sendWishDataPrompt(ctx, ctx.msg.Chat.ID, group.GroupID)
 
 		return nil
 
@@ -624,6 +730,8 @@ func handleWishes(ctx *handleContext) error {
 		return err
 	}
 
+	groups, _ = narrowToArgGroup(ctx, groups, false)
+
 	switch len(groups) {
 	case 0:
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -635,89 +743,7 @@ func handleWishes(ctx *handleContext) error {
 		return nil
 
 	case 1:
-		group := groups[0]
-		wishes, err := db.GetGroupWishes(group.GroupID)
-		if err != nil {
-			return err
-		}
-
-		if len(wishes) == 0 {
-			resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "noWishes",
-					TemplateData: map[string]any{
-						"GroupName": group.Name,
-					},
-				},
-			))
-			bot.HandledSend(resp)
-			return nil
-		}
-
-		var groupedByUser = make(map[int64][]*db.Wish)
-		for _, wish := range wishes {
-			groupedByUser[wish.UserID] = append(groupedByUser[wish.UserID], wish)
-		}
-
-		resp := tgbotapi.NewMessage(
-			ctx.msg.Chat.ID,
-			ctx.localizer.MustLocalize(
-				&i18n.LocalizeConfig{
-					MessageID: "hereAreWishes",
-					TemplateData: map[string]string{
-						"GroupName": group.Name,
-					},
-				},
-			),
-		)
-		bot.HandledSend(resp)
-
-		for user, wishes := range groupedByUser {
-			go func() {
-				user, err := db.GetUser(user)
-				if err != nil {
-					logger.Sugared.Errorw("failed to get user for wishes display", "user_id", user, "err", err)
-					return
-				}
-
-				text := ""
-
-				if user.UserID == ctx.msg.From.ID {
-					text += ctx.localizer.MustLocalize(
-						&i18n.LocalizeConfig{
-							MessageID: "yourWishes",
-						},
-					)
-				} else {
-					text += ctx.localizer.MustLocalize(
-						&i18n.LocalizeConfig{
-							MessageID: "userWishes",
-							TemplateData: map[string]interface{}{
-								"Username": user.Username,
-							},
-						},
-					)
-				}
-				text += "\n\n"
-
-				for idx, wish := range wishes {
-					text += fmt.Sprintf(
-						"%d. %s\n%s\n\n",
-						idx+1,
-						wish.URL,
-						wish.Description,
-					)
-				}
-
-				resp := tgbotapi.NewMessage(
-					ctx.msg.Chat.ID,
-					text,
-				)
-				bot.HandledSend(resp)
-			}()
-		}
-
-		return nil
+		return sendWishList(ctx, ctx.msg.Chat.ID, 0, groups[0], WISH_LIST_VIEW, 0)
 
 	default:
 		resp := tgbotapi.NewMessage(
@@ -0,0 +1,171 @@
+package tgbot
+
+import (
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DIGEST_CHECK_INTERVAL is how often the scheduler looks for due digests.
+const DIGEST_CHECK_INTERVAL = 10 * time.Minute
+
+// DIGEST_WEEKDAY is the day weekly digests are sent on.
+const DIGEST_WEEKDAY = time.Sunday
+
+// DIGEST_DETAILS_LIMIT is the maximum length of the details of a single change in a digest.
+const DIGEST_DETAILS_LIMIT = 200
+
+// WatchDigests periodically sends daily and weekly digests of wish changes to members who chose them.
+// It blocks, so it is meant to be run in its own goroutine.
+func WatchDigests() {
+	for {
+		sendDigests(time.Now().UTC())
+		time.Sleep(DIGEST_CHECK_INTERVAL)
+	}
+}
+
+// sendDigests sends every digest that is due at now.
+func sendDigests(now time.Time) {
+	settings, err := db.GetDigestSettings()
+	if err != nil {
+		logger.Sugared.Errorw("failed to get digest settings", "err", err)
+		return
+	}
+
+	for _, setting := range settings {
+		user, err := db.GetUser(setting.UserID)
+		if err != nil {
+			logger.Sugared.Errorw("error getting user for digest", "user_id", setting.UserID, "error", err)
+			continue
+		}
+
+		sentAt, err := db.ParseTime(setting.DigestSentAt)
+		if err != nil {
+			logger.Sugared.Errorw("invalid digest time", "user_id", setting.UserID, "group_id", setting.GroupID, "err", err)
+			continue
+		}
+		if !sentAt.Before(lastDigestSlot(setting.Mode, now.In(user.Location()))) {
+			continue
+		}
+
+		events, err := db.GetDigestEvents(setting.GroupID, setting.UserID, setting.DigestEventID)
+		if err != nil {
+			logger.Sugared.Errorw("failed to get digest events", "user_id", setting.UserID, "group_id", setting.GroupID, "err", err)
+			continue
+		}
+
+		// quiet periods are skipped without a message, but still count as sent
+		lastEventID := setting.DigestEventID
+		if len(events) > 0 {
+			delivered, err := sendDigest(user, setting, events)
+			if err != nil {
+				logger.Sugared.Errorw("failed to send digest", "user_id", setting.UserID, "group_id", setting.GroupID, "err", err)
+				// the delivered part is not sent again, the rest is retried on the next check
+				if delivered != 0 {
+					if err := db.MarkDigestEventsSent(setting.UserID, setting.GroupID, delivered); err != nil {
+						logger.Sugared.Errorw("failed to mark digest events sent", "user_id", setting.UserID, "group_id", setting.GroupID, "err", err)
+					}
+				}
+				continue
+			}
+			lastEventID = delivered
+		}
+
+		if err := db.MarkDigestSent(setting.UserID, setting.GroupID, lastEventID); err != nil {
+			logger.Sugared.Errorw("failed to mark digest sent", "user_id", setting.UserID, "group_id", setting.GroupID, "err", err)
+		}
+	}
+}
+
+// lastDigestSlot returns the latest time at or before now a digest of the given mode was scheduled for.
+// Digests are scheduled in the time zone of now.
+func lastDigestSlot(mode string, now time.Time) time.Time {
+	slot := time.Date(now.Year(), now.Month(), now.Day(), env.Vars.DigestHour, 0, 0, 0, now.Location())
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+
+	if mode == db.NOTIFY_WEEKLY {
+		daysSince := (int(slot.Weekday()) - int(DIGEST_WEEKDAY) + 7) % 7
+		slot = slot.AddDate(0, 0, -daysSince)
+	}
+
+	return slot
+}
+
+// sendDigest sends a member the wish changes in a group, split into as many messages as needed.
+// Returns the id of the last event that reached the member, 0 if none did.
+func sendDigest(user *db.User, setting *db.NotificationSetting, events []*db.AuditEvent) (int64, error) {
+	group, err := db.GetGroup(setting.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	localizer := locals.GetLocalizer(user.Language)
+
+	templateData := map[string]any{
+		"GroupName": html.EscapeString(group.Name),
+		"Count":     len(events),
+	}
+	header := &i18n.LocalizeConfig{
+		MessageID:    "dailyDigestHeader",
+		TemplateData: templateData,
+		PluralCount:  len(events),
+	}
+	if setting.Mode == db.NOTIFY_WEEKLY {
+		header = &i18n.LocalizeConfig{
+			MessageID:    "weeklyDigestHeader",
+			TemplateData: templateData,
+			PluralCount:  len(events),
+		}
+	}
+	footer := localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "digestFooter",
+		},
+	)
+
+	send := func(text string) error {
+		msg := tgbotapi.NewMessage(user.ChatID, strings.TrimSpace(text))
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.DisableWebPagePreview = true
+		return sendNotification(user, msg)
+	}
+
+	// the footer only goes below the last message, but every message leaves room for it
+	budget := MESSAGE_TEXT_LIMIT - utf8.RuneCountInString(footer) - 2
+
+	text := localizer.MustLocalize(header) + "\n"
+	var delivered, lastEventID int64
+	names := make(map[int64]string)
+	for _, event := range events {
+		// details are cut before rendering, cutting the rendered html could break it
+		shown := *event
+		shown.Details = truncateText(event.Details, DIGEST_DETAILS_LIMIT)
+		line := renderAuditEvent(localizer, user, &shown, names)
+
+		if text != "" && utf8.RuneCountInString(text)+utf8.RuneCountInString(line)+1 > budget {
+			if err := send(text); err != nil {
+				return delivered, err
+			}
+			delivered = lastEventID
+			text = ""
+		}
+
+		text += "\n" + line
+		lastEventID = event.EventID
+	}
+
+	if err := send(text + "\n\n" + footer); err != nil {
+		return delivered, err
+	}
+	return lastEventID, nil
+}
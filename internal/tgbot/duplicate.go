@@ -0,0 +1,182 @@
+package tgbot
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/urlnorm"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DUPLICATE_TITLE_SIMILARITY is the share of words two descriptions must have in common to be considered the same wish.
+const DUPLICATE_TITLE_SIMILARITY = 0.75
+
+// pendingWish is a wish waiting for the confirmation of its owner.
+type pendingWish struct {
+	groupID     int64
+	url         string
+	description string
+}
+
+// findDuplicateWishes returns the wishes of a group with the same normalized url or a similar description.
+func findDuplicateWishes(groupID int64, wishURL string, description string) ([]*db.Wish, error) {
+	wishes, err := db.GetGroupWishes(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	words := titleWords(description)
+	key := urlnorm.Key(wishURL)
+
+	var duplicates []*db.Wish
+	for _, wish := range wishes {
+		// wishes created before urls were normalized are stored as sent
+		if urlnorm.Key(normalizeWishURL(wish.URL)) == key || titleSimilarity(words, titleWords(wish.Description)) >= DUPLICATE_TITLE_SIMILARITY {
+			duplicates = append(duplicates, wish)
+		}
+	}
+
+	return duplicates, nil
+}
+
+// titleWords splits a description into a set of lower cased words, ignoring single letters and punctuation.
+func titleWords(description string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 1 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// titleSimilarity returns the share of words two descriptions have in common, from 0 to 1.
+// Descriptions of less than two words are too short to compare, so they are never similar.
+func titleSimilarity(a map[string]bool, b map[string]bool) float64 {
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+
+	common := 0
+	for word := range a {
+		if b[word] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// askAddDuplicateWish warns the user that they already have the same wish in the group.
+// The wish is kept in the state until they confirm.
+func askAddDuplicateWish(ctx *handleContext, groupID int64, wishURL string, description string, duplicate *db.Wish) error {
+	State.setPendingDuplicateWish(ctx.user.UserID, &pendingWish{
+		groupID:     groupID,
+		url:         wishURL,
+		description: description,
+	})
+
+	return sendAreYouSure(&areYouSureConfig{
+		localizer: ctx.localizer,
+		chatID:    ctx.user.ChatID,
+		message: ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "duplicateOwnWish",
+				TemplateData: map[string]any{
+					"WishText": html.EscapeString(strings.TrimSpace(duplicate.URL + "\n" + duplicate.Description)),
+				},
+			},
+		),
+		actionID:     ADD_DUPLICATE_WISH_ACTION,
+		callbackData: fmt.Sprintf("%d", groupID),
+	})
+}
+
+func handleAddDuplicateWish(dataOffset int, ctx *handleContext) error {
+	wish, ok := getPendingDuplicateWish(ctx.callbackQuery.From.ID)
+	if !ok || fmt.Sprintf("%d", wish.groupID) != ctx.callbackQuery.Data[dataOffset:] {
+		edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "duplicateWishExpired",
+			},
+		))
+		bot.HandledSend(edit)
+		return nil
+	}
+
+	duplicates, err := findDuplicateWishes(wish.groupID, wish.url, wish.description)
+	if err != nil {
+		return err
+	}
+
+	return addWish(ctx, ctx.callbackQuery.Message.MessageID, wish.groupID, wish.url, wish.description, duplicates)
+}
+
+// notifySameWish quietly lets the other members know that several members wish for the same thing.
+// The owners of the wishes are not notified, gifts are a surprise.
+func notifySameWish(group *db.Group, creator *db.User, wish *db.Wish, duplicates []*db.Wish) {
+	owners := make(map[int64]bool)
+	var ownerNames []string
+	for _, duplicate := range duplicates {
+		if duplicate.UserID == creator.UserID || owners[duplicate.UserID] {
+			continue
+		}
+		owners[duplicate.UserID] = true
+
+		owner, err := db.GetUser(duplicate.UserID)
+		if err != nil {
+			logger.Sugared.Errorw("failed to get wish owner for same wish notification", "user_id", duplicate.UserID, "err", err)
+			continue
+		}
+		ownerNames = append(ownerNames, owner.DisplayName())
+	}
+	if len(ownerNames) == 0 {
+		return
+	}
+
+	members, err := db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group members for same wish notification", "group_id", group.GroupID, "err", err)
+		return
+	}
+
+	for _, member := range members {
+		if member.UserID == creator.UserID || owners[member.UserID] {
+			continue
+		}
+		go func() {
+			user, err := db.GetUser(member.UserID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", member.UserID, "error", err)
+				return
+			}
+
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			msg := tgbotapi.NewMessage(
+				user.ChatID,
+				userLocalizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "sameWishNotification",
+						TemplateData: map[string]any{
+							"Username":       creator.DisplayName(),
+							"OtherUsernames": strings.Join(ownerNames, ", "),
+							"GroupName":      group.Name,
+							"WishURL":        wish.URL,
+						},
+					},
+				),
+			)
+			msg.DisableWebPagePreview = true
+			sendNotification(user, msg)
+		}()
+	}
+}
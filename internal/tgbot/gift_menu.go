@@ -0,0 +1,126 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/aybolid/wishbot/internal/db"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// GIFT_MENU_CALLBACK_PREFIX is followed by the wish id, e.g. "gift_menu:1".
+const GIFT_MENU_CALLBACK_PREFIX = "gift_menu:"
+
+// handleGiftMenuCallback edits the wish list into the gift actions for a wish of another member.
+func handleGiftMenuCallback(ctx *handleContext) error {
+	wishID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(GIFT_MENU_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, ok, err := getGiftWish(ctx, wishID)
+	if err != nil || !ok {
+		return err
+	}
+
+	group, err := db.GetGroup(wish.GroupID)
+	if err != nil {
+		return err
+	}
+	list, err := getViewWishList(ctx, group)
+	if err != nil {
+		return err
+	}
+	number := getViewWishNumber(list, wish.WishID)
+	page := list.findPage(func(item listItem) bool { return item.wishID == wish.WishID })
+
+	text := formatWishItem(number, wish)
+	if wishPrice := getWishPrice(ctx.localizer, wish.WishID); wishPrice != "" {
+		text += "\n" + wishPrice
+	}
+	if progress := getPoolProgress(ctx.localizer, wish.WishID); progress != "" {
+		text += "\n" + progress
+	}
+	if templates := getMemberTemplatesText(wish.GroupID, wish.UserID); templates != "" {
+		text += "\n\n" + templates
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "chipIn",
+					},
+				),
+				fmt.Sprintf("%s%d", POOL_CALLBACK_PREFIX, wish.WishID),
+			),
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "recordPurchase",
+					},
+				),
+				fmt.Sprintf("%s%d", PURCHASE_CALLBACK_PREFIX, wish.WishID),
+			),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "copyWish",
+					},
+				),
+				fmt.Sprintf("%s%d", COPY_WISH_CALLBACK_PREFIX, wish.WishID),
+			),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "backToList",
+					},
+				),
+				fmt.Sprintf("%s%s:%d:%d", WISH_LIST_CALLBACK_PREFIX, WISH_LIST_VIEW, wish.GroupID, page),
+			),
+		),
+	)
+	sendOrEditMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, text, "", &keyboard)
+
+	return nil
+}
+
+// getGiftWish returns a wish the user who pressed a button may buy or chip in for.
+// Returns false if the wish is the user's own, the user is told with a toast.
+func getGiftWish(ctx *handleContext, wishID int64) (*db.Wish, bool, error) {
+	wish, err := db.GetWish(wishID)
+	if err == sql.ErrNoRows {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishNotFound",
+			},
+		)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if wish.UserID == ctx.callbackQuery.From.ID {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "giftOwnWish",
+			},
+		)
+		return nil, false, nil
+	}
+
+	// only members of the wish group can buy it
+	if _, err := db.GetGroupMember(wish.GroupID, ctx.callbackQuery.From.ID); err != nil {
+		return nil, false, err
+	}
+
+	return wish, true, nil
+}
@@ -0,0 +1,268 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const BIND_CHAT_CALLBACK_PREFIX = "bind_chat:"
+
+// groupChatCommands are the commands available in telegram group chats.
+// Every other feature stays in private chats, pending flows are never started from group chats.
+var groupChatCommands = []*command{
+	{
+		name:                 "bindgroup",
+		handler:              handleBindGroup,
+		args:                 []argSpec{optionalGroupArg},
+		descriptionMessageID: "commandBindGroup",
+	},
+	{name: "unbindgroup", handler: handleUnbindGroup, descriptionMessageID: "commandUnbindGroup"},
+}
+
+// handleGroupChatMessage processes messages sent to telegram group chats the bot is a member of.
+// With privacy mode enabled the bot only receives commands, replies and service messages from group chats,
+// so members are enrolled once they use a command or join the chat.
+func handleGroupChatMessage(ctx *handleContext) error {
+	logger.Sugared.Infow("received group chat message", "text", ctx.msg.Text, "chat_id", ctx.msg.Chat.ID, "from", ctx.msg.From)
+
+	if ctx.msg.MigrateToChatID != 0 {
+		return db.MigrateGroupChat(ctx.msg.Chat.ID, ctx.msg.MigrateToChatID)
+	}
+
+	if ctx.msg.LeftChatMember != nil && ctx.msg.LeftChatMember.ID == bot.Self.ID {
+		return db.UnbindGroupChat(ctx.msg.Chat.ID)
+	}
+
+	for _, member := range ctx.msg.NewChatMembers {
+		if member.ID == bot.Self.ID {
+			resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "botAddedToChat",
+				},
+			))
+			bot.HandledSend(resp)
+		}
+	}
+
+	group, err := db.GetGroupByChatID(ctx.msg.Chat.ID)
+	switch err {
+	case nil:
+		enrollChatMember(group, ctx.msg.From)
+		for _, member := range ctx.msg.NewChatMembers {
+			enrollChatMember(group, &member)
+		}
+	case sql.ErrNoRows:
+	default:
+		return err
+	}
+
+	if ctx.msg.IsCommand() {
+		return routeCommand(ctx, groupChatCommands)
+	}
+
+	return nil
+}
+
+// enrollChatMember adds a member of a bound telegram group chat to the bound group.
+// Users that never talked to the bot are created on the fly.
+func enrollChatMember(group *db.Group, tgUser *tgbotapi.User) {
+	if tgUser.IsBot {
+		return
+	}
+
+	user, err := db.GetUser(tgUser.ID)
+	if err == sql.ErrNoRows {
+		// the private chat id of a user is the same as the user id
+		user, err = db.CreateUser(tgUser, tgUser.ID, locals.MatchLanguage(tgUser.LanguageCode))
+	}
+	if err != nil {
+		logger.Sugared.Errorw("failed to get user for chat enrollment", "user_id", tgUser.ID, "err", err)
+		return
+	}
+	user = refreshUserProfile(user, tgUser)
+
+	_, err = db.GetGroupMember(group.GroupID, user.UserID)
+	if err == nil {
+		return
+	}
+	if err != sql.ErrNoRows {
+		logger.Sugared.Errorw("failed to get group member for chat enrollment", "user_id", user.UserID, "group_id", group.GroupID, "err", err)
+		return
+	}
+
+	if _, err := db.CreateGroupMember(group.GroupID, user.UserID); err != nil {
+		logger.Sugared.Errorw("failed to enroll chat member", "user_id", user.UserID, "group_id", group.GroupID, "err", err)
+		return
+	}
+
+	localizer, err := getGroupChatLocalizer(group)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group chat localizer", "group_id", group.GroupID, "err", err)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(group.ChatID, localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "chatMemberEnrolled",
+			TemplateData: map[string]any{
+				"Username":  tgUser.FirstName,
+				"GroupName": group.Name,
+				"BotName":   bot.Self.UserName,
+			},
+		},
+	))
+	bot.HandledSend(msg)
+}
+
+func handleBindGroup(ctx *handleContext) error {
+	groups, err := db.GetOwnedGroups(ctx.msg.From.ID)
+	if err != nil {
+		return err
+	}
+
+	groups, ok := narrowToArgGroup(ctx, groups, true)
+	if !ok {
+		return nil
+	}
+
+	switch len(groups) {
+	case 0:
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "bindNoOwnedGroups",
+				TemplateData: map[string]any{
+					"BotName": bot.Self.UserName,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+
+	case 1:
+		return bindChat(ctx, groups[0], ctx.msg.Chat.ID)
+
+	default:
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "bindGroupMenu",
+			},
+		))
+
+		resp.ReplyMarkup = getGroupSelectKeyboard(groups, func(group *db.Group) string {
+			return fmt.Sprintf("%s%d", BIND_CHAT_CALLBACK_PREFIX, group.GroupID)
+		})
+		resp.ParseMode = tgbotapi.ModeHTML
+
+		bot.HandledSend(resp)
+
+		return nil
+	}
+}
+
+func handleBindChatCallback(ctx *handleContext) error {
+	groupID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(BIND_CHAT_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	return bindChat(ctx, group, ctx.callbackQuery.Message.Chat.ID)
+}
+
+// bindChat binds a group to a telegram group chat if the user handling the update owns the group.
+func bindChat(ctx *handleContext, group *db.Group, chatID int64) error {
+	if group.OwnerID != ctx.user.UserID {
+		logger.Sugared.Errorw("not the owner of the group", "group_id", group.GroupID, "owner_id", group.OwnerID, "user_id", ctx.user.UserID)
+		text := ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notOwner",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		)
+		// anyone in the chat can press the buttons, so the menu stays for the owner
+		if ctx.callbackQuery != nil {
+			ctx.callbackAnswer = text
+			return nil
+		}
+		bot.HandledSend(tgbotapi.NewMessage(chatID, text))
+		return nil
+	}
+
+	if err := db.BindGroupChat(group.GroupID, chatID); err != nil {
+		return err
+	}
+
+	text := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "chatBound",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	)
+	if ctx.callbackQuery != nil {
+		bot.HandledSend(newCallbackEdit(ctx, text))
+	} else {
+		bot.HandledSend(tgbotapi.NewMessage(chatID, text))
+	}
+
+	return nil
+}
+
+func handleUnbindGroup(ctx *handleContext) error {
+	group, err := db.GetGroupByChatID(ctx.msg.Chat.ID)
+	if err == sql.ErrNoRows {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "chatNotBound",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerID != ctx.msg.From.ID {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notOwner",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	if err := db.UnbindGroupChat(ctx.msg.Chat.ID); err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "chatUnbound",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
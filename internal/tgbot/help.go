@@ -0,0 +1,106 @@
+package tgbot
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// registerCommands registers the command menu for private and group chats in every supported language.
+// Clients without a supported language get the English menu.
+func registerCommands() {
+	scopes := []struct {
+		scope    tgbotapi.BotCommandScope
+		commands []*command
+	}{
+		{tgbotapi.NewBotCommandScopeAllPrivateChats(), privateCommands},
+		{tgbotapi.NewBotCommandScopeAllGroupChats(), groupChatCommands},
+	}
+	// the private chat id of a user is the same as the user id
+	for _, adminID := range env.Vars.AdminUserIDs {
+		scopes = append(scopes, struct {
+			scope    tgbotapi.BotCommandScope
+			commands []*command
+		}{tgbotapi.NewBotCommandScopeChat(adminID), getPrivateCommands(adminID)})
+	}
+
+	for _, scope := range scopes {
+		bot.HandledRequest(tgbotapi.NewSetMyCommandsWithScope(
+			scope.scope,
+			getBotCommands(locals.GetLocalizer(locals.ENGLISH), scope.commands)...,
+		))
+
+		for _, language := range locals.Languages {
+			bot.HandledRequest(tgbotapi.NewSetMyCommandsWithScopeAndLanguage(
+				scope.scope,
+				language,
+				getBotCommands(locals.GetLocalizer(language), scope.commands)...,
+			))
+		}
+	}
+
+	logger.Sugared.Infow("registered bot commands", "languages", locals.Languages)
+}
+
+// getBotCommands converts registry commands to the command menu format.
+func getBotCommands(localizer *locals.Localizer, commands []*command) []tgbotapi.BotCommand {
+	botCommands := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		if cmd.hidden {
+			continue
+		}
+		botCommands = append(botCommands, tgbotapi.BotCommand{
+			Command: cmd.name,
+			Description: localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: cmd.descriptionMessageID,
+				},
+			),
+		})
+	}
+	return botCommands
+}
+
+func handleHelp(ctx *handleContext) error {
+	var text strings.Builder
+
+	text.WriteString(ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "helpHeader",
+		},
+	))
+	text.WriteString("\n\n")
+
+	for _, cmd := range getPrivateCommands(ctx.user.UserID) {
+		if cmd.hidden {
+			continue
+		}
+		text.WriteString(fmt.Sprintf(
+			"<code>%s</code>\n%s\n\n",
+			html.EscapeString(cmd.usage(ctx)),
+			html.EscapeString(ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: cmd.descriptionMessageID,
+				},
+			)),
+		))
+	}
+
+	text.WriteString(ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "helpFooter",
+		},
+	))
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, text.String())
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package tgbot
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// HISTORY_CALLBACK_PREFIX is followed by the group id and the offset of the page, e.g. "history:1:10".
+const HISTORY_CALLBACK_PREFIX = "history:"
+
+const HISTORY_PAGE_SIZE = 10
+
+// auditEventMessages maps audit event types to the messages rendering them in the history.
+var auditEventMessages = map[string]i18n.LocalizeConfig{
+	db.AUDIT_MEMBER_JOINED:         {MessageID: "historyMemberJoined"},
+	db.AUDIT_MEMBER_LEFT:           {MessageID: "historyMemberLeft"},
+	db.AUDIT_MEMBER_KICKED:         {MessageID: "historyMemberKicked"},
+	db.AUDIT_WISH_CREATED:          {MessageID: "historyWishCreated"},
+	db.AUDIT_WISH_DELETED:          {MessageID: "historyWishDeleted"},
+	db.AUDIT_WISH_UPDATED:          {MessageID: "historyWishUpdated"},
+	db.AUDIT_OWNERSHIP_TRANSFERRED: {MessageID: "historyOwnershipTransferred"},
+}
+
+func handleHistory(ctx *handleContext) error {
+	groups, err := db.GetOwnedGroups(ctx.msg.From.ID)
+	if err != nil {
+		return err
+	}
+
+	groups, ok := narrowToArgGroup(ctx, groups, true)
+	if !ok {
+		return nil
+	}
+
+	switch len(groups) {
+	case 0:
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noOwnedGroups",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+
+	case 1:
+		return sendHistoryPage(ctx, ctx.msg.Chat.ID, 0, groups[0], 0)
+
+	default:
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "historyMenu",
+			},
+		))
+		resp.ReplyMarkup = getGroupSelectKeyboard(groups, func(group *db.Group) string {
+			return fmt.Sprintf("%s%d:0", HISTORY_CALLBACK_PREFIX, group.GroupID)
+		})
+		resp.ParseMode = tgbotapi.ModeHTML
+		bot.HandledSend(resp)
+		return nil
+	}
+}
+
+func handleHistoryCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(HISTORY_CALLBACK_PREFIX):], ":")
+	if len(payload) != 2 {
+		return fmt.Errorf("invalid history callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	groupID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	offset, err := strconv.Atoi(payload[1])
+	if err != nil {
+		return err
+	}
+
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	// only owners may see the history, even if they kept an old keyboard around
+	if group.OwnerID != ctx.callbackQuery.From.ID {
+		logger.Sugared.Errorw("not the owner of the group", "group_id", group.GroupID, "owner_id", group.OwnerID, "user_id", ctx.callbackQuery.From.ID)
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notOwner",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		)
+		return nil
+	}
+
+	return sendHistoryPage(ctx, ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, group, offset)
+}
+
+// sendHistoryPage sends a page of the audit events of a group, starting at offset.
+// If messageID is not 0, the message is edited in place instead.
+func sendHistoryPage(ctx *handleContext, chatID int64, messageID int, group *db.Group, offset int) error {
+	count, err := db.CountGroupEvents(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "historyEmpty",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		), "", nil)
+		return nil
+	}
+
+	if offset < 0 || offset >= count {
+		offset = 0
+	}
+
+	events, err := db.GetGroupEvents(group.GroupID, HISTORY_PAGE_SIZE, offset)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "historyHeader",
+			TemplateData: map[string]any{
+				"GroupName": html.EscapeString(group.Name),
+				"Page":      offset/HISTORY_PAGE_SIZE + 1,
+				"PageCount": (count + HISTORY_PAGE_SIZE - 1) / HISTORY_PAGE_SIZE,
+			},
+		},
+	)}
+
+	names := make(map[int64]string)
+	for _, event := range events {
+		lines = append(lines, renderAuditEvent(ctx.localizer, ctx.user, event, names))
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if offset > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			"‹",
+			fmt.Sprintf("%s%d:%d", HISTORY_CALLBACK_PREFIX, group.GroupID, max(offset-HISTORY_PAGE_SIZE, 0)),
+		))
+	}
+	if offset+HISTORY_PAGE_SIZE < count {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			"›",
+			fmt.Sprintf("%s%d:%d", HISTORY_CALLBACK_PREFIX, group.GroupID, offset+HISTORY_PAGE_SIZE),
+		))
+	}
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	if len(buttons) > 0 {
+		markup := tgbotapi.NewInlineKeyboardMarkup(buttons)
+		keyboard = &markup
+	}
+
+	sendOrEditMessage(chatID, messageID, strings.Join(lines, "\n"), tgbotapi.ModeHTML, keyboard)
+
+	return nil
+}
+
+// renderAuditEvent renders a single history line.
+// The time is shown in the time zone of user.
+func renderAuditEvent(localizer *locals.Localizer, user *db.User, event *db.AuditEvent, names map[int64]string) string {
+	config, ok := auditEventMessages[event.EventType]
+	if !ok {
+		logger.Sugared.Errorw("unknown audit event type", "event_id", event.EventID, "event_type", event.EventType)
+		return ""
+	}
+
+	deletedUser := localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "historyDeletedUser",
+		},
+	)
+
+	// events without a subject and events whose subject deleted their account both have no subject
+	subject := ""
+	if event.SubjectID != 0 {
+		subject = getEventUserName(event.SubjectID, deletedUser, names)
+	}
+
+	config.TemplateData = map[string]any{
+		"Time":        formatUserTime(user, event.CreatedAt),
+		"Actor":       html.EscapeString(getEventUserName(event.ActorID, deletedUser, names)),
+		"Subject":     html.EscapeString(subject),
+		"DeletedUser": deletedUser,
+		"Details":     html.EscapeString(event.Details),
+	}
+	return localizer.MustLocalize(&config)
+}
+
+// getEventUserName returns the display name of a user taking part in an audit event.
+// Names caches display names by user id across events.
+func getEventUserName(userID int64, deletedUser string, names map[int64]string) string {
+	if name, ok := names[userID]; ok {
+		return name
+	}
+
+	name := deletedUser
+	if userID != 0 {
+		if user, err := db.GetUser(userID); err == nil {
+			name = user.DisplayName()
+		}
+	}
+
+	names[userID] = name
+	return name
+}
@@ -0,0 +1,320 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/urlnorm"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// IDEAS_CALLBACK_PREFIX is followed by the group id a wish is being added to and optionally an idea category,
+// e.g. "ideas:1:books".
+const IDEAS_CALLBACK_PREFIX = "ideas:"
+
+// COPY_WISH_CALLBACK_PREFIX is followed by the wish id and optionally the group id to copy it to, e.g. "copy_wish:1:2".
+const COPY_WISH_CALLBACK_PREFIX = "copy_wish:"
+
+// IDEAS_PAST_WISHES opens the wishes of the user in their other groups instead of a category.
+const IDEAS_PAST_WISHES = "past"
+
+// IDEAS_BUTTONS_PER_ROW limits the amount of category buttons in a single keyboard row.
+const IDEAS_BUTTONS_PER_ROW = 2
+
+// wishIdea is a category of gifts suggested to users who don't know what to wish for.
+type wishIdea struct {
+	key    string
+	button i18n.LocalizeConfig
+	hint   i18n.LocalizeConfig
+}
+
+var wishIdeas = []wishIdea{
+	{key: "books", button: i18n.LocalizeConfig{MessageID: "ideaBooks"}, hint: i18n.LocalizeConfig{MessageID: "ideaBooksHint"}},
+	{key: "experiences", button: i18n.LocalizeConfig{MessageID: "ideaExperiences"}, hint: i18n.LocalizeConfig{MessageID: "ideaExperiencesHint"}},
+	{key: "clothing", button: i18n.LocalizeConfig{MessageID: "ideaClothing"}, hint: i18n.LocalizeConfig{MessageID: "ideaClothingHint"}},
+	{key: "tech", button: i18n.LocalizeConfig{MessageID: "ideaTech"}, hint: i18n.LocalizeConfig{MessageID: "ideaTechHint"}},
+	{key: "home", button: i18n.LocalizeConfig{MessageID: "ideaHome"}, hint: i18n.LocalizeConfig{MessageID: "ideaHomeHint"}},
+	{key: "hobbies", button: i18n.LocalizeConfig{MessageID: "ideaHobbies"}, hint: i18n.LocalizeConfig{MessageID: "ideaHobbiesHint"}},
+}
+
+// sendWishDataPrompt asks the user for the wish to add to a group, offering ideas for the undecided.
+func sendWishDataPrompt(ctx *handleContext, chatID int64, groupID int64) {
+	resp := tgbotapi.NewMessage(
+		chatID,
+		ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "sendWishData",
+			},
+		),
+	)
+	resp.ParseMode = tgbotapi.ModeMarkdownV2
+	resp.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "wishIdeas",
+					},
+				),
+				fmt.Sprintf("%s%d", IDEAS_CALLBACK_PREFIX, groupID),
+			),
+		),
+	)
+	bot.HandledSend(resp)
+
+	State.setPendingWishCreation(ctx.user.UserID, groupID)
+}
+
+// handleIdeasCallback edits the wish prompt into the idea categories or the hints of a category.
+// The user stays pending wish creation, so the wish can be sent right after reading the hints.
+func handleIdeasCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(IDEAS_CALLBACK_PREFIX):], ":")
+	if len(payload) > 2 {
+		return fmt.Errorf("invalid ideas callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	groupID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	backButton := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+		ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "backToIdeas",
+			},
+		),
+		fmt.Sprintf("%s%d", IDEAS_CALLBACK_PREFIX, group.GroupID),
+	))
+
+	if len(payload) == 1 {
+		return sendIdeasMenu(ctx, group)
+	}
+
+	if payload[1] == IDEAS_PAST_WISHES {
+		return sendPastWishes(ctx, group, backButton)
+	}
+
+	idx := slices.IndexFunc(wishIdeas, func(idea wishIdea) bool { return idea.key == payload[1] })
+	if idx == -1 {
+		return fmt.Errorf("unknown wish idea: %s", payload[1])
+	}
+	hint := wishIdeas[idx].hint
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(backButton)
+	sendOrEditMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, ctx.localizer.MustLocalize(&hint), "", &keyboard)
+
+	return nil
+}
+
+// sendIdeasMenu edits the message the callback query came from into the idea categories.
+func sendIdeasMenu(ctx *handleContext, group *db.Group) error {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, idea := range wishIdeas {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(&idea.button),
+			fmt.Sprintf("%s%d:%s", IDEAS_CALLBACK_PREFIX, group.GroupID, idea.key),
+		))
+		if len(row) == IDEAS_BUTTONS_PER_ROW {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	pastWishes, err := getPastWishes(ctx.user.UserID, group.GroupID)
+	if err != nil {
+		return err
+	}
+	if len(pastWishes) > 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "ideaPastWishes",
+				},
+			),
+			fmt.Sprintf("%s%d:%s", IDEAS_CALLBACK_PREFIX, group.GroupID, IDEAS_PAST_WISHES),
+		)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	sendOrEditMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "ideasMenu",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	), "", &keyboard)
+
+	return nil
+}
+
+// sendPastWishes edits the message the callback query came from into the wishes of the user in other groups,
+// each with a button copying it to the group.
+func sendPastWishes(ctx *handleContext, group *db.Group, backButton []tgbotapi.InlineKeyboardButton) error {
+	wishes, err := getPastWishes(ctx.user.UserID, group.GroupID)
+	if err != nil {
+		return err
+	}
+	if len(wishes) > LIST_PAGE_SIZE {
+		wishes = wishes[:LIST_PAGE_SIZE]
+	}
+
+	lines := []string{ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "pastWishesHeader",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	)}
+	var buttons []tgbotapi.InlineKeyboardButton
+	for idx, wish := range wishes {
+		lines = append(lines, formatWishItem(idx+1, wish))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("📋 %d", idx+1),
+			fmt.Sprintf("%s%d:%d", COPY_WISH_CALLBACK_PREFIX, wish.WishID, group.GroupID),
+		))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for len(buttons) > 0 {
+		n := min(len(buttons), LIST_BUTTONS_PER_ROW)
+		rows = append(rows, buttons[:n])
+		buttons = buttons[n:]
+	}
+	rows = append(rows, backButton)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	text := truncateText(strings.Join(lines, "\n\n"), MESSAGE_TEXT_LIMIT)
+	sendOrEditMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, text, "", &keyboard)
+
+	return nil
+}
+
+// getPastWishes returns the wishes of the user in groups other than groupID, newest first.
+// Links already wished for in the group are left out, as are repeated links.
+func getPastWishes(userID int64, groupID int64) ([]*db.Wish, error) {
+	groups, err := db.GetUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	current, err := db.GetUserWishes(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, wish := range current {
+		seen[urlnorm.Key(wish.URL)] = true
+	}
+
+	var wishes []*db.Wish
+	for _, group := range groups {
+		if group.GroupID == groupID {
+			continue
+		}
+		groupWishes, err := db.GetUserWishes(userID, group.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, wish := range groupWishes {
+			if key := urlnorm.Key(wish.URL); !seen[key] {
+				seen[key] = true
+				wishes = append(wishes, wish)
+			}
+		}
+	}
+
+	slices.SortStableFunc(wishes, func(a, b *db.Wish) int {
+		return strings.Compare(b.CreatedAt, a.CreatedAt)
+	})
+
+	return wishes, nil
+}
+
+// handleCopyWishCallback copies a wish the user can see into one of their own lists.
+// Without a target group the user picks one, unless they only have a single group.
+func handleCopyWishCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(COPY_WISH_CALLBACK_PREFIX):], ":")
+	if len(payload) > 2 {
+		return fmt.Errorf("invalid copy wish callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	wishID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, err := db.GetWish(wishID)
+	if err == sql.ErrNoRows {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishNotFound",
+			},
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	groups, err := db.GetUserGroups(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	// only wishes of the user's groups may be copied
+	if !slices.ContainsFunc(groups, func(group *db.Group) bool { return group.GroupID == wish.GroupID }) {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishNotFound",
+			},
+		)
+		return nil
+	}
+
+	if len(payload) == 2 {
+		groupID, err := strconv.ParseInt(payload[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(groups, func(group *db.Group) bool { return group.GroupID == groupID }) {
+			return fmt.Errorf("user %d is not a member of group %d", ctx.user.UserID, groupID)
+		}
+		return createWish(ctx, groupID, wish.URL, wish.Description)
+	}
+
+	if len(groups) == 1 {
+		return createWish(ctx, groups[0].GroupID, wish.URL, wish.Description)
+	}
+
+	resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "copyWishMenu",
+			TemplateData: map[string]any{
+				"WishText": strings.TrimSpace(wish.URL + "\n" + wish.Description),
+			},
+		},
+	))
+	resp.DisableWebPagePreview = true
+	resp.ReplyMarkup = getGroupSelectKeyboard(groups, func(group *db.Group) string {
+		return fmt.Sprintf("%s%d:%d", COPY_WISH_CALLBACK_PREFIX, wish.WishID, group.GroupID)
+	})
+	bot.HandledSend(resp)
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package tgbot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// Inline mode has to be enabled with @BotFather (/setinline).
+// Chosen inline results are only delivered with inline feedback enabled (/setinlinefeedback).
+
+const (
+	// INLINE_RESULTS_LIMIT is the maximum amount of results Telegram accepts per inline query answer.
+	INLINE_RESULTS_LIMIT = 50
+	// INLINE_CACHE_TIME is the amount of seconds Telegram may cache inline query results.
+	INLINE_CACHE_TIME = 10
+	// INLINE_TITLE_LIMIT keeps inline result titles readable in the results popup.
+	INLINE_TITLE_LIMIT = 64
+	// INLINE_START_PARAMETER is sent with /start when a user comes from the inline mode button.
+	INLINE_START_PARAMETER = "inline"
+)
+
+const (
+	INLINE_WISH_RESULT_PREFIX = "wish:"
+	INLINE_LIST_RESULT_PREFIX = "list:"
+)
+
+func handleInlineQuery(ctx *handleContext) error {
+	logger.Sugared.Infow("handling inline query", "query", ctx.inlineQuery.Query, "from", ctx.inlineQuery.From)
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: ctx.inlineQuery.ID,
+		CacheTime:     INLINE_CACHE_TIME,
+		IsPersonal:    true,
+		Results:       []any{},
+	}
+
+	// the user never talked to the bot, so there is nothing to search yet
+	if ctx.user == nil {
+		answer.SwitchPMText = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "inlineStartBot",
+			},
+		)
+		answer.SwitchPMParameter = INLINE_START_PARAMETER
+		bot.HandledRequest(answer)
+		return nil
+	}
+
+	listResults, err := getInlineListResults(ctx)
+	if err != nil {
+		return err
+	}
+	answer.Results = append(answer.Results, listResults...)
+
+	wishResults, err := getInlineWishResults(ctx, INLINE_RESULTS_LIMIT-len(answer.Results))
+	if err != nil {
+		return err
+	}
+	answer.Results = append(answer.Results, wishResults...)
+
+	if len(answer.Results) == 0 {
+		answer.SwitchPMText = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "inlineNoResults",
+			},
+		)
+		answer.SwitchPMParameter = INLINE_START_PARAMETER
+	}
+
+	bot.HandledRequest(answer)
+
+	return nil
+}
+
+func handleChosenInlineResult(ctx *handleContext) error {
+	logger.Sugared.Infow("inline result chosen",
+		"result_id", ctx.chosenInlineResult.ResultID,
+		"query", ctx.chosenInlineResult.Query,
+		"from", ctx.chosenInlineResult.From,
+	)
+	return nil
+}
+
+// getInlineListResults returns one result per group the user has wishes in.
+// Choosing such a result shares the whole list of the user's wishes for that group.
+// Groups are matched by name, an empty query matches every group.
+func getInlineListResults(ctx *handleContext) ([]any, error) {
+	groups, err := db.GetUserGroups(ctx.user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := strings.ToLower(strings.TrimSpace(ctx.inlineQuery.Query))
+	results := make([]any, 0)
+
+	for _, group := range groups {
+		if query != "" && !strings.Contains(strings.ToLower(group.Name), query) {
+			continue
+		}
+
+		wishes, err := db.GetUserWishes(ctx.user.UserID, group.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if len(wishes) == 0 {
+			continue
+		}
+
+		text := ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "inlineSharedList",
+				TemplateData: map[string]any{
+					"Username":  ctx.user.DisplayName(),
+					"GroupName": group.Name,
+				},
+			},
+		)
+		text += "\n\n"
+		for idx, wish := range wishes {
+			text += fmt.Sprintf(
+				"%d. %s\n%s\n\n",
+				idx+1,
+				wish.URL,
+				wish.Description,
+			)
+		}
+
+		article := tgbotapi.NewInlineQueryResultArticle(
+			fmt.Sprintf("%s%d", INLINE_LIST_RESULT_PREFIX, group.GroupID),
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "inlineListTitle",
+					TemplateData: map[string]any{
+						"GroupName": group.Name,
+					},
+				},
+			),
+			truncateText(strings.TrimSpace(text), MESSAGE_TEXT_LIMIT),
+		)
+		article.Description = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID:   "inlineListDescription",
+				PluralCount: len(wishes),
+				TemplateData: map[string]any{
+					"WishCount": len(wishes),
+				},
+			},
+		)
+		results = append(results, article)
+	}
+
+	return results, nil
+}
+
+// getInlineWishResults returns one result per wish matching the inline query.
+// Only wishes of groups the user belongs to are searched.
+func getInlineWishResults(ctx *handleContext, limit int) ([]any, error) {
+	results := make([]any, 0)
+	if limit <= 0 {
+		return results, nil
+	}
+
+	wishes, err := db.SearchWishes(ctx.user.UserID, ctx.inlineQuery.Query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[int64]*db.User)
+	groups := make(map[int64]*db.Group)
+
+	for _, wish := range wishes {
+		owner, ok := users[wish.UserID]
+		if !ok {
+			owner, err = db.GetUser(wish.UserID)
+			if err != nil {
+				return nil, err
+			}
+			users[wish.UserID] = owner
+		}
+
+		group, ok := groups[wish.GroupID]
+		if !ok {
+			group, err = db.GetGroup(wish.GroupID)
+			if err != nil {
+				return nil, err
+			}
+			groups[wish.GroupID] = group
+		}
+
+		text := ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "inlineSharedWish",
+				TemplateData: map[string]any{
+					"Username": owner.DisplayName(),
+				},
+			},
+		)
+		text += fmt.Sprintf("\n\n%s\n%s", wish.URL, wish.Description)
+
+		title := wish.Description
+		if title == "" {
+			title = wish.URL
+		}
+
+		article := tgbotapi.NewInlineQueryResultArticle(
+			fmt.Sprintf("%s%d", INLINE_WISH_RESULT_PREFIX, wish.WishID),
+			truncateText(strings.SplitN(title, "\n", 2)[0], INLINE_TITLE_LIMIT),
+			truncateText(strings.TrimSpace(text), MESSAGE_TEXT_LIMIT),
+		)
+		article.Description = fmt.Sprintf("%s · %s", owner.DisplayName(), group.Name)
+		results = append(results, article)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,78 @@
+package tgbot
+
+import (
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+const SET_LANGUAGE_CALLBACK_PREFIX = "set_language:"
+
+func handleLanguage(ctx *handleContext) error {
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "languageMenu",
+		},
+	))
+	resp.ReplyMarkup = getLanguageKeyboard(ctx.user.Language)
+
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// getLanguageKeyboard returns a keyboard with a button for every supported language.
+// Languages are named in their own language, so anyone can find theirs.
+func getLanguageKeyboard(current string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	for _, lang := range locals.Languages {
+		name := getLanguageName(lang)
+		if lang == current {
+			name = "✅ " + name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(name, SET_LANGUAGE_CALLBACK_PREFIX+lang),
+		))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// getLanguageName returns the name of a language in that language, e.g. "Українська" for "uk".
+func getLanguageName(lang string) string {
+	tag := language.Make(lang)
+	name := display.Self.Name(tag)
+	if name == "" {
+		return lang
+	}
+	return cases.Title(tag).String(name)
+}
+
+func handleSetLanguageCallback(ctx *handleContext) error {
+	newLanguage := ctx.callbackQuery.Data[len(SET_LANGUAGE_CALLBACK_PREFIX):]
+	if !locals.IsSupported(newLanguage) {
+		logger.Sugared.Errorw("unsupported language selected", "language", newLanguage, "user_id", ctx.user.UserID)
+		return nil
+	}
+
+	if err := db.UpdateLanguage(ctx.user.UserID, newLanguage); err != nil {
+		return err
+	}
+
+	newLocalizer := locals.GetLocalizer(newLanguage)
+
+	edit := newCallbackEdit(ctx, newLocalizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "languageChanged",
+		},
+	))
+	bot.HandledSend(edit)
+
+	return nil
+}
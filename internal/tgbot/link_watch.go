@@ -0,0 +1,234 @@
+package tgbot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/linkcheck"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/price"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// UPDATE_WISH_URL_CALLBACK_PREFIX is followed by the wish id, e.g. "update_wish_url:1".
+const UPDATE_WISH_URL_CALLBACK_PREFIX = "update_wish_url:"
+
+// WatchLinks periodically checks the urls of all wishes and asks owners to fix broken ones.
+// It blocks, so it is meant to be run in its own goroutine.
+func WatchLinks(checker *linkcheck.Checker) {
+	interval := env.Vars.LinkCheckInterval
+	if interval == 0 {
+		logger.Sugared.Infow("link checking is disabled")
+		return
+	}
+
+	for {
+		checkLinks(checker)
+		time.Sleep(interval)
+	}
+}
+
+// checkLinks checks the url of every wish and records the result.
+func checkLinks(checker *linkcheck.Checker) {
+	wishes, err := db.GetAllWishes()
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wishes for link check", "err", err)
+		return
+	}
+
+	logger.Sugared.Infow("checking wish links", "wishes", len(wishes))
+
+	// the same link is often wished for in several groups
+	results := make(map[string]linkcheck.Result)
+
+	for _, wish := range wishes {
+		result, ok := results[wish.URL]
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), price.DEFAULT_FETCH_TIMEOUT)
+			result = checker.Check(ctx, wish.URL)
+			cancel()
+			results[wish.URL] = result
+			time.Sleep(PRICE_FETCH_DELAY)
+		}
+
+		healthy := result.Status == linkcheck.STATUS_OK
+		if err := db.RecordLinkCheck(wish.WishID, result.Status, result.StatusCode, result.FinalURL, healthy); err != nil {
+			// the wish may have been deleted in the meantime
+			logger.Sugared.Errorw("failed to record link check", "wish_id", wish.WishID, "err", err)
+			continue
+		}
+		if !result.Broken() {
+			continue
+		}
+
+		firstTime, err := db.MarkLinkNotified(wish.WishID, result.Status)
+		if err != nil {
+			logger.Sugared.Errorw("failed to mark link notified", "wish_id", wish.WishID, "err", err)
+			continue
+		}
+		if firstTime {
+			notifyBrokenLink(wish, result.Status)
+		}
+	}
+
+	logger.Sugared.Infow("checked wish links", "pages", len(results))
+}
+
+// notifyBrokenLink asks the wish owner to update or delete a wish whose link stopped working.
+func notifyBrokenLink(wish *db.Wish, status string) {
+	owner, err := db.GetUser(wish.UserID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wish owner for link notification", "user_id", wish.UserID, "err", err)
+		return
+	}
+	group, err := db.GetGroup(wish.GroupID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group for link notification", "group_id", wish.GroupID, "err", err)
+		return
+	}
+
+	localizer := locals.GetLocalizer(owner.Language)
+
+	templateData := map[string]any{
+		"GroupName": group.Name,
+		"WishURL":   wish.URL,
+	}
+	config := &i18n.LocalizeConfig{MessageID: "deadLinkNotification", TemplateData: templateData}
+	if status == linkcheck.STATUS_OUT_OF_STOCK {
+		config = &i18n.LocalizeConfig{MessageID: "outOfStockNotification", TemplateData: templateData}
+	}
+
+	msg := tgbotapi.NewMessage(owner.ChatID, localizer.MustLocalize(config))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "updateWishURL",
+					},
+				),
+				fmt.Sprintf("%s%d", UPDATE_WISH_URL_CALLBACK_PREFIX, wish.WishID),
+			),
+			tgbotapi.NewInlineKeyboardButtonData(
+				localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "deleteWishButton",
+					},
+				),
+				fmt.Sprintf("%s%d", DELETE_WISH_CALLBACK_PREFIX, wish.WishID),
+			),
+		),
+	)
+	sendNotification(owner, msg)
+}
+
+func handleUpdateWishURLCallback(ctx *handleContext) error {
+	wishID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(UPDATE_WISH_URL_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, err := db.GetWish(wishID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.callbackAnswer = ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "wishNotFound",
+				},
+			)
+			return nil
+		}
+		return err
+	}
+	if wish.UserID != ctx.callbackQuery.From.ID {
+		logger.Sugared.Errorw("not the owner of the wish", "wish_id", wishID, "user_id", ctx.callbackQuery.From.ID)
+		return nil
+	}
+
+	State.setPendingWishURLUpdate(ctx.callbackQuery.From.ID, wishID)
+
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "sendNewWishURL",
+			TemplateData: map[string]any{
+				"WishURL": wish.URL,
+			},
+		},
+	))
+	edit.DisableWebPagePreview = true
+	bot.HandledSend(edit)
+
+	return nil
+}
+
+func handleUpdatingWishURLFlow(ctx *handleContext) error {
+	wishID, ok := getPendingWishURLUpdate(ctx.msg.From.ID)
+	if !ok {
+		State.releaseUser(ctx.msg.From.ID)
+		return fmt.Errorf("user is not pending wish url update")
+	}
+
+	wishURL, _ := getMessageURL(ctx.msg)
+	if wishURL == "" {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "errorNoURL",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	wishURL = normalizeWishURL(wishURL)
+	if _, err := db.UpdateWishURL(wishID, wishURL, ctx.msg.From.ID); err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	State.releaseUser(ctx.msg.From.ID)
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "wishURLUpdated",
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// getWishLinkWarning returns a localized line warning that the link of a wish is broken.
+// Returns an empty string if the link works or was not checked yet.
+func getWishLinkWarning(localizer *locals.Localizer, wishID int64) string {
+	link, err := db.GetWishLink(wishID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Sugared.Errorw("failed to get wish link", "wish_id", wishID, "err", err)
+		}
+		return ""
+	}
+
+	switch link.Status {
+	case linkcheck.STATUS_DEAD:
+		return localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishLinkDead",
+			},
+		)
+	case linkcheck.STATUS_OUT_OF_STOCK:
+		return localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishLinkOutOfStock",
+			},
+		)
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package tgbot
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/locals"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// NOTIFICATIONS_CALLBACK_PREFIX is followed by the group id and optionally the new mode, e.g. "notifications:1:daily".
+// Without a group id it opens the list of groups.
+const NOTIFICATIONS_CALLBACK_PREFIX = "notifications:"
+
+// notificationModeMessages maps notification modes to their labels.
+var notificationModeMessages = map[string]i18n.LocalizeConfig{
+	db.NOTIFY_INSTANT: {MessageID: "notifyInstant"},
+	db.NOTIFY_DAILY:   {MessageID: "notifyDaily"},
+	db.NOTIFY_WEEKLY:  {MessageID: "notifyWeekly"},
+	db.NOTIFY_OFF:     {MessageID: "notifyOff"},
+}
+
+func handleNotifications(ctx *handleContext) error {
+	groups, err := db.GetUserGroups(ctx.msg.From.ID)
+	if err != nil {
+		return err
+	}
+
+	groups, ok := narrowToArgGroup(ctx, groups, false)
+	if !ok {
+		return nil
+	}
+
+	switch len(groups) {
+	case 0:
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noGroups",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+
+	case 1:
+		return sendGroupNotificationsMenu(ctx, ctx.msg.Chat.ID, 0, groups[0], false)
+
+	default:
+		return sendNotificationsMenu(ctx, ctx.msg.Chat.ID, 0, groups)
+	}
+}
+
+func handleNotificationsCallback(ctx *handleContext) error {
+	data := ctx.callbackQuery.Data[len(NOTIFICATIONS_CALLBACK_PREFIX):]
+	chatID := ctx.callbackQuery.Message.Chat.ID
+	messageID := ctx.callbackQuery.Message.MessageID
+
+	groups, err := db.GetUserGroups(ctx.callbackQuery.From.ID)
+	if err != nil {
+		return err
+	}
+
+	if data == "" {
+		return sendNotificationsMenu(ctx, chatID, messageID, groups)
+	}
+
+	payload := strings.Split(data, ":")
+	if len(payload) > 2 {
+		return fmt.Errorf("invalid notifications callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	groupID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	// the user may have left the group since the menu was sent
+	if !slices.ContainsFunc(groups, func(g *db.Group) bool { return g.GroupID == groupID }) {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notGroupMember",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		)
+		return nil
+	}
+
+	if len(payload) == 2 {
+		mode := payload[1]
+		if !slices.Contains(db.NotificationModes, mode) {
+			return fmt.Errorf("invalid notification mode: %s", mode)
+		}
+		if err := db.SetNotificationMode(ctx.callbackQuery.From.ID, group.GroupID, mode); err != nil {
+			return err
+		}
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notificationsSaved",
+			},
+		)
+	}
+
+	return sendGroupNotificationsMenu(ctx, chatID, messageID, group, len(groups) > 1)
+}
+
+// sendNotificationsMenu lists the groups of the user along with their notification modes.
+// If messageID is not 0, the message is edited in place instead.
+func sendNotificationsMenu(ctx *handleContext, chatID int64, messageID int, groups []*db.Group) error {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		mode, err := db.GetNotificationMode(ctx.user.UserID, group.GroupID)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%s: %s", group.Name, localizeNotificationMode(ctx.localizer, mode)),
+			fmt.Sprintf("%s%d", NOTIFICATIONS_CALLBACK_PREFIX, group.GroupID),
+		)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "notificationsMenu",
+		},
+	), "", &keyboard)
+
+	return nil
+}
+
+// sendGroupNotificationsMenu lets the user pick how they hear about wish changes in a group.
+// If messageID is not 0, the message is edited in place instead.
+func sendGroupNotificationsMenu(ctx *handleContext, chatID int64, messageID int, group *db.Group, withBack bool) error {
+	current, err := db.GetNotificationMode(ctx.user.UserID, group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, mode := range db.NotificationModes {
+		label := localizeNotificationMode(ctx.localizer, mode)
+		if mode == current {
+			label = "✓ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			label,
+			fmt.Sprintf("%s%d:%s", NOTIFICATIONS_CALLBACK_PREFIX, group.GroupID, mode),
+		)))
+	}
+	if withBack {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "backToList",
+				},
+			),
+			NOTIFICATIONS_CALLBACK_PREFIX,
+		)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "notificationsGroupMenu",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+				"Hour":      fmt.Sprintf("%02d:00", env.Vars.DigestHour),
+			},
+		},
+	), "", &keyboard)
+
+	return nil
+}
+
+// localizeNotificationMode returns the label of a notification mode.
+func localizeNotificationMode(localizer *locals.Localizer, mode string) string {
+	config := notificationModeMessages[mode]
+	return localizer.MustLocalize(&config)
+}
@@ -0,0 +1,81 @@
+package tgbot
+
+import (
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// notificationRenderer renders a notification text in the language of a localizer.
+type notificationRenderer = func(localizer *locals.Localizer) string
+
+// notifyGroup announces group activity, such as new wishes or upcoming events, to group members.
+// Groups bound to a telegram group chat get a single announcement in that chat,
+// otherwise every member except the actor is notified in a private chat.
+func notifyGroup(group *db.Group, actorID int64, render notificationRenderer) error {
+	return sendGroupNotification(group, actorID, false, render)
+}
+
+// notifyGroupWish announces a wish change like notifyGroup.
+// Members who chose a digest or turned notifications off for the group are skipped in private chats,
+// digests pick the change up from the audit events.
+func notifyGroupWish(group *db.Group, actorID int64, render notificationRenderer) error {
+	return sendGroupNotification(group, actorID, true, render)
+}
+
+func sendGroupNotification(group *db.Group, actorID int64, instantOnly bool, render notificationRenderer) error {
+	if group.ChatID != 0 {
+		localizer, err := getGroupChatLocalizer(group)
+		if err != nil {
+			return err
+		}
+
+		msg := tgbotapi.NewMessage(group.ChatID, render(localizer))
+		bot.HandledSend(msg)
+		return nil
+	}
+
+	members, err := db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.UserID == actorID {
+			continue
+		}
+
+		if instantOnly {
+			mode, err := db.GetNotificationMode(member.UserID, group.GroupID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting notification mode", "user_id", member.UserID, "group_id", group.GroupID, "error", err)
+			} else if mode != db.NOTIFY_INSTANT {
+				continue
+			}
+		}
+
+		go func() {
+			user, err := db.GetUser(member.UserID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", member.UserID, "error", err)
+				return
+			}
+
+			msg := tgbotapi.NewMessage(user.ChatID, render(locals.GetLocalizer(user.Language)))
+			sendNotification(user, msg)
+		}()
+	}
+
+	return nil
+}
+
+// getGroupChatLocalizer returns the localizer used for messages in a bound group chat.
+// Group chats have no language of their own, so the language of the group owner is used.
+func getGroupChatLocalizer(group *db.Group) (*locals.Localizer, error) {
+	owner, err := db.GetUser(group.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return locals.GetLocalizer(owner.Language), nil
+}
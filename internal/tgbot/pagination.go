@@ -0,0 +1,161 @@
+package tgbot
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aybolid/wishbot/internal/locals"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// LIST_PAGE_SIZE limits the amount of items on a single page of a list.
+const LIST_PAGE_SIZE = 10
+
+// LIST_BUTTONS_PER_ROW limits the amount of item buttons in a single keyboard row.
+const LIST_BUTTONS_PER_ROW = 5
+
+// LIST_PAGE_RESERVE is the amount of characters kept free on every page for the page indicator.
+const LIST_PAGE_RESERVE = 32
+
+// listItem is a single entry of a paginated list.
+type listItem struct {
+	// section is printed above the item unless the previous item on the page has the same section.
+	section string
+	text    string
+	// button is added to the keyboard of the page the item ends up on. Optional.
+	button *tgbotapi.InlineKeyboardButton
+	// userID and wishID tell the member and the wish an item shows, for finding it in the list. Optional.
+	userID int64
+	wishID int64
+}
+
+// pagedList is a list split into pages that fit into a single message each.
+type pagedList struct {
+	header string
+	pages  [][]listItem
+}
+
+// newPagedList splits items into pages of at most LIST_PAGE_SIZE items.
+// A page is closed early if its text would exceed MESSAGE_TEXT_LIMIT.
+// Sections longer than half a page and items longer than a whole page are truncated.
+func newPagedList(header string, items []listItem) *pagedList {
+	list := &pagedList{header: header}
+	budget := MESSAGE_TEXT_LIMIT - utf8.RuneCountInString(header) - LIST_PAGE_RESERVE
+
+	var page []listItem
+	length := 0
+	for _, item := range items {
+		// a section is repeated on every page, so it must leave room for its items
+		item.section = truncateText(item.section, max(budget/2, 1))
+		item.text = truncateText(item.text, max(budget-utf8.RuneCountInString(item.section)-4, 1))
+
+		itemLength := utf8.RuneCountInString(renderListItem(page, item))
+		if len(page) == LIST_PAGE_SIZE || (len(page) > 0 && length+itemLength > budget) {
+			list.pages = append(list.pages, page)
+			page, length = nil, 0
+			// the section is repeated on top of the new page
+			itemLength = utf8.RuneCountInString(renderListItem(page, item))
+		}
+
+		page = append(page, item)
+		length += itemLength
+	}
+	if len(page) > 0 {
+		list.pages = append(list.pages, page)
+	}
+
+	return list
+}
+
+// findPage returns the first page with an item matching the predicate, 0 if there is none.
+func (l *pagedList) findPage(match func(item listItem) bool) int {
+	for page, items := range l.pages {
+		if slices.ContainsFunc(items, match) {
+			return page
+		}
+	}
+	return 0
+}
+
+// render returns the text and the keyboard of a page, clamping the page to the existing ones.
+// PageData returns the callback data opening a page.
+func (l *pagedList) render(localizer *locals.Localizer, page int, pageData func(page int) string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	page = max(min(page, len(l.pages)-1), 0)
+
+	text := l.header + "\n\n"
+	var buttons []tgbotapi.InlineKeyboardButton
+	if len(l.pages) > 0 {
+		for idx, item := range l.pages[page] {
+			text += renderListItem(l.pages[page][:idx], item)
+			if item.button != nil {
+				buttons = append(buttons, *item.button)
+			}
+		}
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for len(buttons) > 0 {
+		n := min(len(buttons), LIST_BUTTONS_PER_ROW)
+		rows = append(rows, buttons[:n])
+		buttons = buttons[n:]
+	}
+
+	if len(l.pages) > 1 {
+		text += localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "listPage",
+				TemplateData: map[string]any{
+					"Page":      page + 1,
+					"PageCount": len(l.pages),
+				},
+			},
+		)
+
+		var nav []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("‹", pageData(page-1)))
+		}
+		if page < len(l.pages)-1 {
+			nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("›", pageData(page+1)))
+		}
+		rows = append(rows, nav)
+	}
+
+	text = strings.TrimSpace(text)
+	if len(rows) == 0 {
+		return text, nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &keyboard
+}
+
+// renderListItem renders an item following the previous items of the same page.
+func renderListItem(previous []listItem, item listItem) string {
+	text := ""
+	if item.section != "" && (len(previous) == 0 || previous[len(previous)-1].section != item.section) {
+		text += item.section + "\n\n"
+	}
+	return text + item.text + "\n\n"
+}
+
+// sendOrEditMessage sends a new message, or edits the message with the given id in place if it is not 0.
+func sendOrEditMessage(chatID int64, messageID int, text string, parseMode string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	if messageID == 0 {
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = parseMode
+		msg.DisableWebPagePreview = true
+		if keyboard != nil {
+			msg.ReplyMarkup = *keyboard
+		}
+		bot.HandledSend(msg)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = parseMode
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = keyboard
+	bot.HandledSend(edit)
+}
@@ -0,0 +1,309 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const POOL_CALLBACK_PREFIX = "pool:"
+
+// getPoolProgress returns a localized progress line for a wish pool.
+// Returns an empty string if nobody is pooling for the wish.
+// Must never be shown to the wish owner.
+func getPoolProgress(localizer *locals.Localizer, wishID int64) string {
+	pool, err := db.GetWishPool(wishID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Sugared.Errorw("failed to get wish pool", "wish_id", wishID, "err", err)
+		}
+		return ""
+	}
+
+	contributions, err := db.GetWishContributions(wishID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wish contributions", "wish_id", wishID, "err", err)
+		return ""
+	}
+
+	total := db.PoolTotal(pool, contributions)
+
+	return localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:   "poolProgress",
+			PluralCount: len(contributions),
+			TemplateData: map[string]any{
+				"Total":       total.String(),
+				"Target":      pool.Target.String(),
+				"PledgeCount": len(contributions),
+			},
+		},
+	)
+}
+
+func handlePoolCallback(ctx *handleContext) error {
+	wishID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(POOL_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, err := db.GetWish(wishID)
+	if err != nil {
+		return err
+	}
+
+	if wish.UserID == ctx.callbackQuery.From.ID {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "poolOwnWish",
+			},
+		)
+		return nil
+	}
+
+	// only members of the wish group can pool for it
+	if _, err := db.GetGroupMember(wish.GroupID, ctx.callbackQuery.From.ID); err != nil {
+		return err
+	}
+
+	pool, err := db.GetWishPool(wishID)
+	if err == sql.ErrNoRows {
+		State.setPendingPoolCreation(ctx.callbackQuery.From.ID, wishID)
+
+		resp := tgbotapi.NewMessage(ctx.callbackQuery.Message.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "poolSendTarget",
+				TemplateData: map[string]any{
+					"WishURL": wish.URL,
+				},
+			},
+		))
+		resp.ParseMode = tgbotapi.ModeHTML
+		bot.HandledSend(resp)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	State.setPendingPledge(ctx.callbackQuery.From.ID, wishID)
+
+	resp := tgbotapi.NewMessage(
+		ctx.callbackQuery.Message.Chat.ID,
+		fmt.Sprintf(
+			"%s\n\n%s\n\n%s",
+			wish.URL,
+			getPoolProgress(ctx.localizer, wishID),
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "poolSendPledge",
+					TemplateData: map[string]any{
+						"Currency": pool.Target.Currency,
+					},
+				},
+			),
+		),
+	)
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handleCreatingPoolFlow(ctx *handleContext) error {
+	wishID, ok := getPendingPoolCreation(ctx.msg.From.ID)
+	if !ok {
+		State.releaseUser(ctx.msg.From.ID)
+		return fmt.Errorf("user is not pending pool creation")
+	}
+
+	target, err := money.Parse(ctx.msg.Text, "")
+	if err != nil || target.Value == 0 {
+		logger.Sugared.Debugw("invalid pool target", "text", ctx.msg.Text, "err", err)
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "poolInvalidTarget",
+			},
+		))
+		resp.ParseMode = tgbotapi.ModeHTML
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	pool, err := db.CreateWishPool(wishID, ctx.msg.From.ID, target)
+	if err != nil {
+		return err
+	}
+
+	State.setPendingPledge(ctx.msg.From.ID, wishID)
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "poolCreated",
+			TemplateData: map[string]any{
+				"Target": pool.Target.String(),
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	resp = tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "poolSendPledge",
+			TemplateData: map[string]any{
+				"Currency": pool.Target.Currency,
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+func handlePledgeFlow(ctx *handleContext) error {
+	wishID, ok := getPendingPledge(ctx.msg.From.ID)
+	if !ok {
+		State.releaseUser(ctx.msg.From.ID)
+		return fmt.Errorf("user is not pending pledge")
+	}
+
+	pool, err := db.GetWishPool(wishID)
+	if err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	amount, err := money.Parse(ctx.msg.Text, pool.Target.Currency)
+	if err != nil {
+		logger.Sugared.Debugw("invalid pledge amount", "text", ctx.msg.Text, "err", err)
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "poolInvalidPledge",
+				TemplateData: map[string]any{
+					"Currency": pool.Target.Currency,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	if amount.Currency != pool.Target.Currency {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "poolCurrencyMismatch",
+				TemplateData: map[string]any{
+					"Currency": pool.Target.Currency,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	State.releaseUser(ctx.msg.From.ID)
+
+	if amount.Value == 0 {
+		if err := db.DeleteContribution(wishID, ctx.msg.From.ID); err != nil {
+			return err
+		}
+
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "pledgeWithdrawn",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	if err := db.SetContribution(wishID, ctx.msg.From.ID, amount); err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, fmt.Sprintf(
+		"%s\n\n%s",
+		ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "pledgeSaved",
+				TemplateData: map[string]any{
+					"Amount": amount.String(),
+				},
+			},
+		),
+		getPoolProgress(ctx.localizer, wishID),
+	))
+	bot.HandledSend(resp)
+
+	contributions, err := db.GetWishContributions(wishID)
+	if err != nil {
+		return err
+	}
+
+	if db.PoolTotal(pool, contributions).Value < pool.Target.Value {
+		return nil
+	}
+
+	firstTime, err := db.MarkWishPoolReached(wishID)
+	if err != nil {
+		return err
+	}
+	if firstTime {
+		notifyPoolReached(wishID, pool, contributions)
+	}
+
+	return nil
+}
+
+// notifyPoolReached lets every pledger know that the pool reached its target.
+func notifyPoolReached(wishID int64, pool *db.WishPool, contributions []*db.Contribution) {
+	wish, err := db.GetWish(wishID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wish for pool notification", "wish_id", wishID, "err", err)
+		return
+	}
+	owner, err := db.GetUser(wish.UserID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wish owner for pool notification", "user_id", wish.UserID, "err", err)
+		return
+	}
+	group, err := db.GetGroup(wish.GroupID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group for pool notification", "group_id", wish.GroupID, "err", err)
+		return
+	}
+
+	for _, contribution := range contributions {
+		go func() {
+			user, err := db.GetUser(contribution.UserID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", contribution.UserID, "error", err)
+				return
+			}
+
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			msg := tgbotapi.NewMessage(
+				user.ChatID,
+				userLocalizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "poolReachedNotification",
+						TemplateData: map[string]any{
+							"Username":  owner.DisplayName(),
+							"GroupName": group.Name,
+							"Target":    pool.Target.String(),
+							"WishURL":   wish.URL,
+						},
+					},
+				),
+			)
+			sendNotification(user, msg)
+		}()
+	}
+}
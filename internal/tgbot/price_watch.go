@@ -0,0 +1,170 @@
+package tgbot
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/money"
+	"github.com/aybolid/wishbot/internal/price"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// PRICE_FETCH_DELAY spaces out page fetches, so shops are not hammered with requests.
+const PRICE_FETCH_DELAY = 2 * time.Second
+
+// WatchPrices periodically checks the prices of all wishes and notifies group members about price drops.
+// It blocks, so it is meant to be run in its own goroutine.
+func WatchPrices(fetcher price.Fetcher) {
+	interval := env.Vars.PriceCheckInterval
+	if interval == 0 {
+		logger.Sugared.Infow("price tracking is disabled")
+		return
+	}
+
+	for {
+		checkPrices(fetcher)
+		time.Sleep(interval)
+	}
+}
+
+// checkPrices fetches the current price of every wish and records it.
+func checkPrices(fetcher price.Fetcher) {
+	wishes, err := db.GetAllWishes()
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wishes for price check", "err", err)
+		return
+	}
+
+	logger.Sugared.Infow("checking wish prices", "wishes", len(wishes))
+
+	// the same link is often wished for in several groups
+	prices := make(map[string]*money.Amount)
+
+	for _, wish := range wishes {
+		amount, ok := prices[wish.URL]
+		if !ok {
+			amount = fetchPrice(fetcher, wish.URL)
+			prices[wish.URL] = amount
+			time.Sleep(PRICE_FETCH_DELAY)
+		}
+		if amount == nil {
+			continue
+		}
+
+		previous, err := db.RecordWishPrice(wish.WishID, amount)
+		if err != nil {
+			// the wish may have been deleted in the meantime
+			logger.Sugared.Errorw("failed to record wish price", "wish_id", wish.WishID, "err", err)
+			continue
+		}
+		if previous == nil {
+			continue
+		}
+
+		if drop, ok := price.Drop(previous.Amount, *amount, env.Vars.PriceDropPercent); ok {
+			notifyPriceDrop(wish, previous.Amount, *amount, drop)
+		}
+	}
+
+	logger.Sugared.Infow("checked wish prices", "pages", len(prices))
+}
+
+// fetchPrice returns the price found on a page, nil if the page is unavailable or has no price.
+func fetchPrice(fetcher price.Fetcher, pageURL string) *money.Amount {
+	ctx, cancel := context.WithTimeout(context.Background(), price.DEFAULT_FETCH_TIMEOUT)
+	defer cancel()
+
+	page, err := fetcher.Fetch(ctx, pageURL)
+	if err != nil {
+		logger.Sugared.Infow("failed to fetch wish page", "url", pageURL, "err", err)
+		return nil
+	}
+
+	amount, err := price.Parse(page)
+	if err != nil {
+		logger.Sugared.Debugw("no price on wish page", "url", pageURL)
+		return nil
+	}
+
+	return amount
+}
+
+// notifyPriceDrop lets the group members know that a wish got cheaper.
+// The wish owner is not notified, gifts are a surprise.
+func notifyPriceDrop(wish *db.Wish, oldPrice money.Amount, newPrice money.Amount, percent int64) {
+	owner, err := db.GetUser(wish.UserID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get wish owner for price notification", "user_id", wish.UserID, "err", err)
+		return
+	}
+	group, err := db.GetGroup(wish.GroupID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group for price notification", "group_id", wish.GroupID, "err", err)
+		return
+	}
+	members, err := db.GetGroupMembers(wish.GroupID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get group members for price notification", "group_id", wish.GroupID, "err", err)
+		return
+	}
+
+	for _, member := range members {
+		if member.UserID == wish.UserID {
+			continue
+		}
+		go func() {
+			user, err := db.GetUser(member.UserID)
+			if err != nil {
+				logger.Sugared.Errorw("error getting user for notification", "user_id", member.UserID, "error", err)
+				return
+			}
+
+			userLocalizer := locals.GetLocalizer(user.Language)
+
+			msg := tgbotapi.NewMessage(
+				user.ChatID,
+				userLocalizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "priceDropNotification",
+						TemplateData: map[string]any{
+							"Username":  owner.DisplayName(),
+							"GroupName": group.Name,
+							"OldPrice":  oldPrice.String(),
+							"NewPrice":  newPrice.String(),
+							"Percent":   percent,
+							"WishURL":   wish.URL,
+						},
+					},
+				),
+			)
+			sendNotification(user, msg)
+		}()
+	}
+}
+
+// getWishPrice returns a localized line with the current price of a wish.
+// Returns an empty string if the price is unknown.
+func getWishPrice(localizer *locals.Localizer, wishID int64) string {
+	wishPrice, err := db.GetLatestWishPrice(wishID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Sugared.Errorw("failed to get wish price", "wish_id", wishID, "err", err)
+		}
+		return ""
+	}
+
+	return localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "wishPrice",
+			TemplateData: map[string]any{
+				"Price": wishPrice.Amount.String(),
+			},
+		},
+	)
+}
@@ -0,0 +1,263 @@
+package tgbot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/locals"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// PROFILE_CALLBACK_PREFIX is followed by an action and a field, e.g. "profile:edit:shoe_size".
+// Without an action it opens the profile card.
+const PROFILE_CALLBACK_PREFIX = "profile:"
+
+// Profile callback actions.
+const (
+	// PROFILE_WIZARD asks for every field one after another.
+	PROFILE_WIZARD = "wizard"
+	// PROFILE_EDIT is followed by the field to change.
+	PROFILE_EDIT = "edit"
+	// PROFILE_SKIP is followed by the field being asked for, its value is kept.
+	PROFILE_SKIP = "skip"
+	// PROFILE_CLEAR is followed by the field being asked for, its value is removed.
+	PROFILE_CLEAR = "clear"
+)
+
+// PROFILE_VALUE_LIMIT limits the length of a single profile field.
+const PROFILE_VALUE_LIMIT = 100
+
+// PROFILE_BUTTONS_PER_ROW limits the amount of field buttons in a single keyboard row.
+const PROFILE_BUTTONS_PER_ROW = 2
+
+// profileLabels names the profile fields.
+var profileLabels = map[string]i18n.LocalizeConfig{
+	db.PROFILE_CLOTHING_SIZE:   {MessageID: "profileClothingSize"},
+	db.PROFILE_SHOE_SIZE:       {MessageID: "profileShoeSize"},
+	db.PROFILE_RING_SIZE:       {MessageID: "profileRingSize"},
+	db.PROFILE_FAVORITE_COLORS: {MessageID: "profileFavoriteColors"},
+	db.PROFILE_ALLERGIES:       {MessageID: "profileAllergies"},
+	db.PROFILE_DISLIKES:        {MessageID: "profileDislikes"},
+}
+
+// profileEdit is the profile field a user is sending a value for.
+type profileEdit struct {
+	field string
+	// wizard is true if the next field is asked for once this one is done.
+	wizard bool
+}
+
+func handleProfile(ctx *handleContext) error {
+	return sendProfileCard(ctx, ctx.msg.Chat.ID, 0)
+}
+
+func handleProfileCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(PROFILE_CALLBACK_PREFIX):], ":")
+	chatID := ctx.callbackQuery.Message.Chat.ID
+	messageID := ctx.callbackQuery.Message.MessageID
+
+	switch {
+	case len(payload) == 1 && payload[0] == "":
+		return sendProfileCard(ctx, chatID, messageID)
+
+	case len(payload) == 1 && payload[0] == PROFILE_WIZARD:
+		edit := &profileEdit{field: db.ProfileFields[0], wizard: true}
+		State.setPendingProfileEdit(ctx.user.UserID, edit)
+		return sendProfilePrompt(ctx, chatID, messageID, edit)
+
+	case len(payload) == 2 && payload[0] == PROFILE_EDIT:
+		if !slices.Contains(db.ProfileFields, payload[1]) {
+			return fmt.Errorf("unknown profile field: %s", payload[1])
+		}
+		edit := &profileEdit{field: payload[1]}
+		State.setPendingProfileEdit(ctx.user.UserID, edit)
+		return sendProfilePrompt(ctx, chatID, messageID, edit)
+
+	case len(payload) == 2 && (payload[0] == PROFILE_SKIP || payload[0] == PROFILE_CLEAR):
+		edit, ok := getPendingProfileEdit(ctx.user.UserID)
+		if !ok || edit.field != payload[1] {
+			// the prompt is outdated, the user finished, canceled or moved on from the edit
+			return sendProfileCard(ctx, chatID, messageID)
+		}
+		if payload[0] == PROFILE_CLEAR {
+			if _, err := db.SetProfileField(ctx.user.UserID, edit.field, ""); err != nil {
+				return err
+			}
+		}
+		return continueProfileEdit(ctx, chatID, messageID, edit)
+
+	default:
+		return fmt.Errorf("invalid profile callback data: %s", ctx.callbackQuery.Data)
+	}
+}
+
+func handleProfileEditFlow(ctx *handleContext) error {
+	edit, ok := getPendingProfileEdit(ctx.msg.From.ID)
+	if !ok {
+		logger.Sugared.Errorw("no pending profile edit", "user_id", ctx.msg.From.ID)
+		return nil
+	}
+
+	value := strings.TrimSpace(ctx.msg.Text)
+	if value == "" || utf8.RuneCountInString(value) > PROFILE_VALUE_LIMIT {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID:    "errorProfileValue",
+				TemplateData: map[string]any{"Limit": PROFILE_VALUE_LIMIT},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	if _, err := db.SetProfileField(ctx.msg.From.ID, edit.field, value); err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	return continueProfileEdit(ctx, ctx.msg.Chat.ID, 0, edit)
+}
+
+// continueProfileEdit asks for the next field of the wizard, or shows the profile card once the edit is done.
+// If messageID is not 0, the message is edited in place instead.
+func continueProfileEdit(ctx *handleContext, chatID int64, messageID int, edit *profileEdit) error {
+	next := slices.Index(db.ProfileFields, edit.field) + 1
+	if edit.wizard && next < len(db.ProfileFields) {
+		edit := &profileEdit{field: db.ProfileFields[next], wizard: true}
+		State.setPendingProfileEdit(ctx.user.UserID, edit)
+		return sendProfilePrompt(ctx, chatID, messageID, edit)
+	}
+
+	State.releaseUser(ctx.user.UserID)
+	return sendProfileCard(ctx, chatID, messageID)
+}
+
+// sendProfilePrompt asks the user for the value of a profile field.
+// If messageID is not 0, the message is edited in place instead.
+func sendProfilePrompt(ctx *handleContext, chatID int64, messageID int, edit *profileEdit) error {
+	profile, err := db.GetProfile(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	label := profileLabels[edit.field]
+	templateData := map[string]any{
+		"Field":   ctx.localizer.MustLocalize(&label),
+		"Current": profile.Field(edit.field),
+		"Step":    slices.Index(db.ProfileFields, edit.field) + 1,
+		"Total":   len(db.ProfileFields),
+	}
+
+	config := &i18n.LocalizeConfig{MessageID: "profileFieldPrompt", TemplateData: templateData}
+	if edit.wizard {
+		config = &i18n.LocalizeConfig{MessageID: "profileWizardPrompt", TemplateData: templateData}
+	}
+
+	skipConfig := &i18n.LocalizeConfig{MessageID: "profileKeep"}
+	if edit.wizard {
+		skipConfig = &i18n.LocalizeConfig{MessageID: "profileSkip"}
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(skipConfig),
+			PROFILE_CALLBACK_PREFIX+PROFILE_SKIP+":"+edit.field,
+		),
+		tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "profileClear",
+				},
+			),
+			PROFILE_CALLBACK_PREFIX+PROFILE_CLEAR+":"+edit.field,
+		),
+	))
+	sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(config), "", &keyboard)
+
+	return nil
+}
+
+// sendProfileCard sends the profile of the user with buttons to change it.
+// If messageID is not 0, the message is edited in place instead.
+func sendProfileCard(ctx *handleContext, chatID int64, messageID int) error {
+	profile, err := db.GetProfile(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	text := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "profileEmpty",
+		},
+	)
+	if !profile.IsEmpty() {
+		text = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "profileCard",
+				TemplateData: map[string]any{
+					"Profile": renderProfile(ctx.localizer, profile),
+				},
+			},
+		)
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "profileWizard",
+				},
+			),
+			PROFILE_CALLBACK_PREFIX+PROFILE_WIZARD,
+		)),
+	}
+	var row []tgbotapi.InlineKeyboardButton
+	for _, field := range db.ProfileFields {
+		label := profileLabels[field]
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(&label),
+			fmt.Sprintf("%s%s:%s", PROFILE_CALLBACK_PREFIX, PROFILE_EDIT, field),
+		))
+		if len(row) == PROFILE_BUTTONS_PER_ROW {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	sendOrEditMessage(chatID, messageID, text, "", &keyboard)
+
+	return nil
+}
+
+// getProfileText renders the profile of a group member, empty if they did not fill it in.
+func getProfileText(localizer *locals.Localizer, userID int64) string {
+	profile, err := db.GetProfile(userID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get profile", "user_id", userID, "err", err)
+		return ""
+	}
+	return renderProfile(localizer, profile)
+}
+
+// renderProfile renders the filled in fields of a profile, one per line, e.g. "👟 Shoe size: 38".
+func renderProfile(localizer *locals.Localizer, profile *db.Profile) string {
+	var lines []string
+	for _, field := range db.ProfileFields {
+		value := profile.Field(field)
+		if value == "" {
+			continue
+		}
+		label := profileLabels[field]
+		lines = append(lines, localizer.MustLocalize(&label)+": "+value)
+	}
+	return strings.Join(lines, "\n")
+}
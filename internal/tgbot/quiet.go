@@ -0,0 +1,272 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DEFERRED_CHECK_INTERVAL is how often messages held back by quiet hours are looked at.
+const DEFERRED_CHECK_INTERVAL = time.Minute
+
+// utcOffsetPattern matches whole hour offsets like "UTC+3", "GMT-5" or "+2".
+var utcOffsetPattern = regexp.MustCompile(`^(?i:utc|gmt)?([+-])(\d{1,2})(?::00)?$`)
+
+// quietHoursPattern matches quiet hours like "22:00-08:00" or "22-8".
+var quietHoursPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*-\s*(\d{1,2})(?::(\d{2}))?$`)
+
+// sendNotification sends a message that is not a reply to something the user did.
+// During the quiet hours of the user it is stored and sent once they end.
+// Returns an error if the message was neither sent nor stored.
+func sendNotification(user *db.User, msg tgbotapi.MessageConfig) error {
+	until, quiet := user.QuietUntil(time.Now())
+	if !quiet {
+		return bot.HandledSend(msg)
+	}
+
+	replyMarkup := ""
+	if keyboard, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+		data, err := json.Marshal(keyboard)
+		if err != nil {
+			logger.Sugared.Errorw("failed to encode deferred keyboard", "user_id", user.UserID, "err", err)
+			return bot.HandledSend(msg)
+		}
+		replyMarkup = string(data)
+	}
+
+	if err := db.DeferMessage(user.UserID, msg.Text, msg.ParseMode, msg.DisableWebPagePreview, replyMarkup, until); err != nil {
+		logger.Sugared.Errorw("failed to defer message, sending it now", "user_id", user.UserID, "err", err)
+		return bot.HandledSend(msg)
+	}
+	return nil
+}
+
+// WatchDeferredMessages sends the messages held back by quiet hours once they end.
+// It blocks, so it is meant to be run in its own goroutine.
+func WatchDeferredMessages() {
+	for {
+		sendDeferredMessages(time.Now())
+		time.Sleep(DEFERRED_CHECK_INTERVAL)
+	}
+}
+
+// sendDeferredMessages sends every deferred message that is due at now.
+func sendDeferredMessages(now time.Time) {
+	messages, err := db.GetDueMessages(now)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get deferred messages", "err", err)
+		return
+	}
+
+	for _, message := range messages {
+		// the message is dropped even if sending fails, the user may have blocked the bot
+		if err := db.DeleteDeferredMessage(message.MessageID); err != nil {
+			logger.Sugared.Errorw("failed to delete deferred message", "message_id", message.MessageID, "err", err)
+			continue
+		}
+
+		user, err := db.GetUser(message.UserID)
+		if err != nil {
+			logger.Sugared.Errorw("error getting user for deferred message", "user_id", message.UserID, "error", err)
+			continue
+		}
+
+		msg := tgbotapi.NewMessage(user.ChatID, message.Text)
+		msg.ParseMode = message.ParseMode
+		msg.DisableWebPagePreview = message.DisablePreview
+		if message.ReplyMarkup != "" {
+			var keyboard tgbotapi.InlineKeyboardMarkup
+			if err := json.Unmarshal([]byte(message.ReplyMarkup), &keyboard); err != nil {
+				logger.Sugared.Errorw("invalid deferred keyboard", "message_id", message.MessageID, "err", err)
+			} else {
+				msg.ReplyMarkup = keyboard
+			}
+		}
+		bot.HandledSend(msg)
+	}
+}
+
+func handleTimezone(ctx *handleContext) error {
+	if ctx.args.text == "" {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "currentTimezone",
+				TemplateData: map[string]any{
+					"Timezone": ctx.user.Timezone,
+					"Time":     time.Now().In(ctx.user.Location()).Format("15:04"),
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	timezone, ok := parseTimezone(ctx.args.text)
+	if !ok {
+		return &argError{
+			messageID:    "argInvalidTimezone",
+			templateData: map[string]any{"Timezone": ctx.args.text},
+		}
+	}
+
+	if err := db.UpdateTimezone(ctx.user.UserID, timezone); err != nil {
+		return err
+	}
+	ctx.user.Timezone = timezone
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "timezoneSet",
+			TemplateData: map[string]any{
+				"Timezone": timezone,
+				"Time":     time.Now().In(ctx.user.Location()).Format("15:04"),
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// parseTimezone returns the IANA name of a time zone, e.g. "Europe/Kyiv" or "UTC+3".
+// Offsets are stored as Etc/GMT zones, whose signs are inverted.
+func parseTimezone(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+
+	if match := utcOffsetPattern.FindStringSubmatch(text); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		if hours == 0 {
+			return "UTC", true
+		}
+		if hours > 14 {
+			return "", false
+		}
+		sign := "-"
+		if match[1] == "-" {
+			sign = "+"
+		}
+		return fmt.Sprintf("Etc/GMT%s%d", sign, hours), true
+	}
+
+	// "Local" and "" would load the zone of the server
+	if text == "" || strings.EqualFold(text, "local") {
+		return "", false
+	}
+	loc, err := time.LoadLocation(text)
+	if err != nil {
+		return "", false
+	}
+	return loc.String(), true
+}
+
+func handleQuiet(ctx *handleContext) error {
+	text := strings.TrimSpace(ctx.args.text)
+
+	if text == "" {
+		config := &i18n.LocalizeConfig{MessageID: "noQuietHours"}
+		if ctx.user.HasQuietHours() {
+			config = &i18n.LocalizeConfig{
+				MessageID: "currentQuietHours",
+				TemplateData: map[string]any{
+					"Start":    formatMinutes(ctx.user.QuietStart),
+					"End":      formatMinutes(ctx.user.QuietEnd),
+					"Timezone": ctx.user.Timezone,
+				},
+			}
+		}
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(config)))
+		return nil
+	}
+
+	if strings.EqualFold(text, "off") {
+		if err := db.UpdateQuietHours(ctx.user.UserID, 0, 0); err != nil {
+			return err
+		}
+		bot.HandledSend(tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "quietHoursOff",
+			},
+		)))
+		return nil
+	}
+
+	start, end, ok := parseQuietHours(text)
+	if !ok {
+		return &argError{
+			messageID:    "argInvalidQuietHours",
+			templateData: map[string]any{"QuietHours": text},
+		}
+	}
+
+	if err := db.UpdateQuietHours(ctx.user.UserID, start, end); err != nil {
+		return err
+	}
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "quietHoursSet",
+			TemplateData: map[string]any{
+				"Start":    formatMinutes(start),
+				"End":      formatMinutes(end),
+				"Timezone": ctx.user.Timezone,
+			},
+		},
+	))
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// parseQuietHours parses quiet hours like "22:00-08:00" into minutes since midnight.
+func parseQuietHours(text string) (int, int, bool) {
+	match := quietHoursPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	start, ok := parseClock(match[1], match[2])
+	if !ok {
+		return 0, 0, false
+	}
+	end, ok := parseClock(match[3], match[4])
+	if !ok || start == end {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
+
+// parseClock returns the minutes since midnight of an hour and an optional minute.
+func parseClock(hour string, minute string) (int, bool) {
+	h, _ := strconv.Atoi(hour)
+	m := 0
+	if minute != "" {
+		m, _ = strconv.Atoi(minute)
+	}
+	if h > 23 || m > 59 {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+// formatMinutes formats minutes since midnight, e.g. "22:00".
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// formatUserTime renders a stored UTC timestamp in the time zone of a user, e.g. "2024-12-24 18:30 EET".
+func formatUserTime(user *db.User, value string) string {
+	t, err := db.ParseTime(value)
+	if err != nil {
+		return value
+	}
+	return t.In(user.Location()).Format("2006-01-02 15:04 MST")
+}
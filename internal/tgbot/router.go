@@ -0,0 +1,334 @@
+package tgbot
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+type argKind int
+
+const (
+	// GROUP_ARG is the name of a group the user belongs to. Group names may contain spaces.
+	GROUP_ARG argKind = iota
+	// URL_ARG is a single http or https URL.
+	URL_ARG
+	// USERNAMES_ARG is one or more @username mentions.
+	USERNAMES_ARG
+	// TEXT_ARG is the rest of the command text.
+	TEXT_ARG
+	// ID_ARG is a positive number, such as a group id.
+	ID_ARG
+)
+
+type argSpec struct {
+	kind     argKind
+	optional bool
+	// nameMessageID is used to render the argument in usage help.
+	nameMessageID string
+}
+
+// commandArgs holds arguments parsed according to the argument schema of a command.
+// Zero values mean an optional argument was not passed.
+type commandArgs struct {
+	group     *db.Group
+	url       string
+	usernames []string
+	text      string
+	id        int64
+}
+
+type command struct {
+	// name of the command without the leading slash.
+	name    string
+	handler cmdHandler
+	args    []argSpec
+	// descriptionMessageID is shown in the command menu and in /help.
+	descriptionMessageID string
+	// hidden commands are neither registered in the command menu nor listed in /help.
+	hidden bool
+}
+
+// argError is returned when command arguments don't match the command schema.
+// It is rendered to the user along with the command usage.
+type argError struct {
+	messageID    string
+	templateData map[string]any
+}
+
+func (e *argError) Error() string {
+	return fmt.Sprintf("invalid command arguments: %s %v", e.messageID, e.templateData)
+}
+
+// parseCommand extracts the command name and raw arguments from a message.
+// Returns false if the command is addressed to another bot with the /command@botname syntax.
+func parseCommand(msg *tgbotapi.Message) (name string, args string, ok bool) {
+	name = msg.CommandWithAt()
+	if i := strings.Index(name, "@"); i != -1 {
+		if !strings.EqualFold(name[i+1:], bot.Self.UserName) {
+			return "", "", false
+		}
+		name = name[:i]
+	}
+	return strings.ToLower(name), strings.TrimSpace(msg.CommandArguments()), true
+}
+
+// findCommand looks up a command by name.
+func findCommand(commands []*command, name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// routeCommand parses and validates the arguments of a command message and calls the command handler.
+// Unknown commands and invalid arguments are answered with localized help.
+func routeCommand(ctx *handleContext, commands []*command) error {
+	name, rawArgs, ok := parseCommand(ctx.msg)
+	if !ok {
+		logger.Sugared.Debugw("command addressed to another bot", "command", ctx.msg.Text)
+		return nil
+	}
+
+	cmd := findCommand(commands, name)
+	if cmd == nil {
+		logger.Sugared.Errorw("unknown command received", "command", ctx.msg.Text, "chat_id", ctx.msg.Chat.ID, "from", ctx.msg.From)
+		// commands in group chats may be meant for other bots
+		if !ctx.msg.Chat.IsPrivate() {
+			return nil
+		}
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "unknownCommand",
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	// handlers may also reject arguments that only make sense together
+	args, err := cmd.parseArgs(ctx, rawArgs)
+	if err == nil {
+		ctx.args = args
+		err = cmd.handler(ctx)
+	}
+
+	if argErr, ok := err.(*argError); ok {
+		logger.Sugared.Infow("invalid command arguments", "command", cmd.name, "args", rawArgs, "err", argErr)
+		sendCommandUsage(ctx, cmd, argErr)
+		return nil
+	}
+	return err
+}
+
+// parseArgs parses raw command arguments according to the command schema.
+func (c *command) parseArgs(ctx *handleContext, rawArgs string) (*commandArgs, error) {
+	args := &commandArgs{}
+	rest := rawArgs
+	skippedGroup := false
+
+	for _, spec := range c.args {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			if !spec.optional {
+				return nil, &argError{
+					messageID:    "argMissing",
+					templateData: map[string]any{"Arg": localizeArgName(ctx, spec)},
+				}
+			}
+			continue
+		}
+
+		switch spec.kind {
+		case GROUP_ARG:
+			groups, err := db.GetUserGroups(ctx.user.UserID)
+			if err != nil {
+				return nil, err
+			}
+			group, consumed := matchGroupName(groups, rest)
+			if group == nil {
+				if !spec.optional {
+					return nil, &argError{
+						messageID:    "argGroupNotFound",
+						templateData: map[string]any{"Name": rest},
+					}
+				}
+				// the text may belong to the next argument, e.g. "/addwish https://..."
+				skippedGroup = true
+				continue
+			}
+			args.group = group
+			rest = rest[consumed:]
+
+		case URL_ARG:
+			token, remaining := nextToken(rest)
+			wishURL, ok := parseURLArg(token)
+			if !ok {
+				if spec.optional {
+					continue
+				}
+				return nil, &argError{
+					messageID:    "argInvalidURL",
+					templateData: map[string]any{"URL": token},
+				}
+			}
+			args.url = wishURL
+			rest = remaining
+
+		case USERNAMES_ARG:
+			for {
+				token, remaining := nextToken(rest)
+				if len(token) < 2 || !strings.HasPrefix(token, "@") {
+					break
+				}
+				args.usernames = append(args.usernames, token[1:])
+				rest = remaining
+			}
+			if len(args.usernames) == 0 && !spec.optional {
+				token, _ := nextToken(rest)
+				return nil, &argError{
+					messageID:    "argInvalidUsername",
+					templateData: map[string]any{"Username": token},
+				}
+			}
+
+		case TEXT_ARG:
+			args.text = rest
+			rest = ""
+
+		case ID_ARG:
+			token, remaining := nextToken(rest)
+			id, err := strconv.ParseInt(token, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, &argError{
+					messageID:    "argInvalidID",
+					templateData: map[string]any{"ID": token},
+				}
+			}
+			args.id = id
+			rest = remaining
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" {
+		if skippedGroup {
+			return nil, &argError{
+				messageID:    "argGroupNotFound",
+				templateData: map[string]any{"Name": rest},
+			}
+		}
+		return nil, &argError{
+			messageID:    "argUnexpected",
+			templateData: map[string]any{"Text": rest},
+		}
+	}
+
+	return args, nil
+}
+
+// usage renders the command syntax, e.g. "/addwish [group] [url] [description]".
+// Required arguments are wrapped in angle brackets, optional ones in square brackets.
+func (c *command) usage(ctx *handleContext) string {
+	parts := []string{"/" + c.name}
+	for _, spec := range c.args {
+		if spec.optional {
+			parts = append(parts, fmt.Sprintf("[%s]", localizeArgName(ctx, spec)))
+		} else {
+			parts = append(parts, fmt.Sprintf("<%s>", localizeArgName(ctx, spec)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func sendCommandUsage(ctx *handleContext, cmd *command, argErr *argError) {
+	errorText := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:    argErr.messageID,
+			TemplateData: argErr.templateData,
+		},
+	)
+
+	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "commandUsage",
+			TemplateData: map[string]any{
+				"Error": html.EscapeString(errorText),
+				"Usage": html.EscapeString(cmd.usage(ctx)),
+			},
+		},
+	))
+	resp.ParseMode = tgbotapi.ModeHTML
+	bot.HandledSend(resp)
+}
+
+func localizeArgName(ctx *handleContext, spec argSpec) string {
+	return ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: spec.nameMessageID,
+		},
+	)
+}
+
+// matchGroupName finds the group with the longest name the text starts with.
+// Names are matched case insensitively and must be followed by a space or the end of the text.
+// Returns the amount of bytes of text the group name takes up.
+func matchGroupName(groups []*db.Group, text string) (*db.Group, int) {
+	var match *db.Group
+	for _, group := range groups {
+		name := group.Name
+		if len(name) > len(text) || !strings.EqualFold(text[:len(name)], name) {
+			continue
+		}
+		if len(name) < len(text) && text[len(name)] != ' ' && text[len(name)] != '\n' {
+			continue
+		}
+		if match == nil || len(name) > len(match.Name) {
+			match = group
+		}
+	}
+	if match == nil {
+		return nil, 0
+	}
+	return match, len(match.Name)
+}
+
+// nextToken splits off the first whitespace separated token of a text.
+func nextToken(text string) (token string, rest string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \n\t"); i != -1 {
+		return text[:i], text[i+1:]
+	}
+	return text, ""
+}
+
+// parseURLArg validates a URL argument. URLs without a scheme are assumed to be https.
+func parseURLArg(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	if !strings.Contains(token, "://") {
+		token = "https://" + token
+	}
+
+	parsed, err := url.Parse(token)
+	if err != nil {
+		return "", false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", false
+	}
+	if !strings.Contains(parsed.Host, ".") {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,157 @@
+package tgbot
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// SEARCH_CALLBACK_PREFIX is followed by the page, e.g. "search:1".
+// The query is read from the /search message the results reply to.
+const SEARCH_CALLBACK_PREFIX = "search:"
+
+// SEARCH_RESULTS_LIMIT limits the amount of wishes found by a single search.
+const SEARCH_RESULTS_LIMIT = 100
+
+func handleSearch(ctx *handleContext) error {
+	return sendSearchResults(ctx, ctx.msg.Chat.ID, 0, ctx.msg.MessageID, ctx.args.text, 0)
+}
+
+func handleSearchCallback(ctx *handleContext) error {
+	page, err := strconv.Atoi(ctx.callbackQuery.Data[len(SEARCH_CALLBACK_PREFIX):])
+	if err != nil {
+		return err
+	}
+
+	// the /search message may have been deleted
+	original := ctx.callbackQuery.Message.ReplyToMessage
+	if original == nil || !original.IsCommand() {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "searchExpired",
+			},
+		)
+		return nil
+	}
+	_, query, _ := parseCommand(original)
+
+	return sendSearchResults(
+		ctx,
+		ctx.callbackQuery.Message.Chat.ID,
+		ctx.callbackQuery.Message.MessageID,
+		original.MessageID,
+		query,
+		page,
+	)
+}
+
+// sendSearchResults sends a page of the wishes matching the query as a reply to the /search message.
+// If messageID is not 0, the message is edited in place instead.
+func sendSearchResults(ctx *handleContext, chatID int64, messageID int, replyTo int, query string, page int) error {
+	wishes, err := db.SearchWishes(ctx.user.UserID, query, SEARCH_RESULTS_LIMIT)
+	if err != nil {
+		return err
+	}
+
+	if len(wishes) == 0 {
+		resp := tgbotapi.NewMessage(chatID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noSearchResults",
+				TemplateData: map[string]any{
+					"Query": query,
+				},
+			},
+		))
+		resp.ReplyToMessageID = replyTo
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	groupNames := make(map[int64]string)
+	userNames := make(map[int64]string)
+
+	items := make([]listItem, len(wishes))
+	for idx, wish := range wishes {
+		items[idx] = listItem{
+			section: ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "searchSection",
+					TemplateData: map[string]any{
+						"GroupName": getSearchGroupName(wish.GroupID, groupNames),
+						"Username":  getSearchUserName(wish.UserID, userNames),
+					},
+				},
+			),
+			text: formatWishItem(idx+1, wish),
+		}
+	}
+
+	list := newPagedList(ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID:   "searchResults",
+			PluralCount: len(wishes),
+			TemplateData: map[string]any{
+				"Count": len(wishes),
+				"Query": query,
+			},
+		},
+	), items)
+
+	text, keyboard := list.render(ctx.localizer, page, func(page int) string {
+		return fmt.Sprintf("%s%d", SEARCH_CALLBACK_PREFIX, page)
+	})
+
+	if messageID != 0 {
+		sendOrEditMessage(chatID, messageID, text, "", keyboard)
+		return nil
+	}
+
+	resp := tgbotapi.NewMessage(chatID, text)
+	// page buttons read the query from the replied message
+	resp.ReplyToMessageID = replyTo
+	resp.DisableWebPagePreview = true
+	if keyboard != nil {
+		resp.ReplyMarkup = *keyboard
+	}
+	bot.HandledSend(resp)
+
+	return nil
+}
+
+// getSearchGroupName returns the name of a group, caching names by group id.
+func getSearchGroupName(groupID int64, names map[int64]string) string {
+	if name, ok := names[groupID]; ok {
+		return name
+	}
+
+	name := "?"
+	if group, err := db.GetGroup(groupID); err == nil {
+		name = group.Name
+	} else {
+		logger.Sugared.Errorw("failed to get group for search results", "group_id", groupID, "err", err)
+	}
+
+	names[groupID] = name
+	return name
+}
+
+// getSearchUserName returns the display name of a wish owner, caching names by user id.
+func getSearchUserName(userID int64, names map[int64]string) string {
+	if name, ok := names[userID]; ok {
+		return name
+	}
+
+	name := "?"
+	if user, err := db.GetUser(userID); err == nil {
+		name = user.DisplayName()
+	} else {
+		logger.Sugared.Errorw("failed to get user for search results", "user_id", userID, "err", err)
+	}
+
+	names[userID] = name
+	return name
+}
@@ -12,14 +12,42 @@ type botState struct {
 	// PendingWishCreation tracks users that are currently creating a wish.
 	// user id -> group id
 	PendingWishCreation map[int64]int64
+	// PendingPoolCreation tracks users that are currently sending a target price for a wish pool.
+	// user id -> wish id
+	PendingPoolCreation map[int64]int64
+	// PendingPledge tracks users that are currently pledging to a wish pool.
+	// user id -> wish id
+	PendingPledge map[int64]int64
+	// PendingWishURLUpdate tracks users that are currently sending a new link for a wish.
+	// user id -> wish id
+	PendingWishURLUpdate map[int64]int64
+	// PendingDuplicateWish tracks wishes waiting for their owner to confirm adding a duplicate.
+	// user id -> wish
+	PendingDuplicateWish map[int64]*pendingWish
+	// PendingPurchase tracks users that are currently sending the price they paid for a wish.
+	// user id -> wish id
+	PendingPurchase map[int64]int64
+	// PendingTemplateCreation tracks users that are currently sending a new wish template.
+	// user id -> bool
+	PendingTemplateCreation map[int64]bool
+	// PendingProfileEdit tracks users that are currently sending a value for their profile.
+	// user id -> profile edit
+	PendingProfileEdit map[int64]*profileEdit
 }
 
 // Inner state of the bot.
 // User can only be in one of the actions at a time.
 var State = &botState{
-	PendingGroupCreation:  make(map[int64]bool),
-	PendingInviteCreation: make(map[int64]int64),
-	PendingWishCreation:   make(map[int64]int64),
+	PendingGroupCreation:    make(map[int64]bool),
+	PendingInviteCreation:   make(map[int64]int64),
+	PendingWishCreation:     make(map[int64]int64),
+	PendingPoolCreation:     make(map[int64]int64),
+	PendingPledge:           make(map[int64]int64),
+	PendingWishURLUpdate:    make(map[int64]int64),
+	PendingDuplicateWish:    make(map[int64]*pendingWish),
+	PendingPurchase:         make(map[int64]int64),
+	PendingTemplateCreation: make(map[int64]bool),
+	PendingProfileEdit:      make(map[int64]*profileEdit),
 }
 
 // isPendingGroupCreation returns true if a user is currently creating a group.
@@ -43,6 +71,48 @@ func (s *botState) isPendingWishCreation(userID int64) bool {
 	return ok
 }
 
+// isPendingPoolCreation returns true if a user is currently starting a wish pool.
+func (s *botState) isPendingPoolCreation(userID int64) bool {
+	_, ok := s.PendingPoolCreation[userID]
+	logger.Sugared.Infow("is pending pool creation", "user_id", userID, "pending", ok)
+	return ok
+}
+
+// isPendingPledge returns true if a user is currently pledging to a wish pool.
+func (s *botState) isPendingPledge(userID int64) bool {
+	_, ok := s.PendingPledge[userID]
+	logger.Sugared.Infow("is pending pledge", "user_id", userID, "pending", ok)
+	return ok
+}
+
+// isPendingWishURLUpdate returns true if a user is currently updating the link of a wish.
+func (s *botState) isPendingWishURLUpdate(userID int64) bool {
+	_, ok := s.PendingWishURLUpdate[userID]
+	logger.Sugared.Infow("is pending wish url update", "user_id", userID, "pending", ok)
+	return ok
+}
+
+// isPendingPurchase returns true if a user is currently recording a purchase.
+func (s *botState) isPendingPurchase(userID int64) bool {
+	_, ok := s.PendingPurchase[userID]
+	logger.Sugared.Infow("is pending purchase", "user_id", userID, "pending", ok)
+	return ok
+}
+
+// isPendingTemplateCreation returns true if a user is currently creating a wish template.
+func (s *botState) isPendingTemplateCreation(userID int64) bool {
+	_, ok := s.PendingTemplateCreation[userID]
+	logger.Sugared.Infow("is pending template creation", "user_id", userID, "pending", ok)
+	return ok
+}
+
+// isPendingProfileEdit returns true if a user is currently editing their profile.
+func (s *botState) isPendingProfileEdit(userID int64) bool {
+	_, ok := s.PendingProfileEdit[userID]
+	logger.Sugared.Infow("is pending profile edit", "user_id", userID, "pending", ok)
+	return ok
+}
+
 // setPendingGroupCreation marks a user as pending group creation. Releases the user beforehand.
 func (s *botState) setPendingGroupCreation(userID int64) {
 	s.releaseUser(userID)
@@ -66,6 +136,62 @@ func (s *botState) setPendingWishCreation(userID int64, groupID int64) {
 	s.PendingWishCreation[userID] = groupID
 }
 
+// setPendingPoolCreation marks a user as pending pool creation.
+// Releases the user beforehand.
+func (s *botState) setPendingPoolCreation(userID int64, wishID int64) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending pool creation", "user_id", userID)
+	s.PendingPoolCreation[userID] = wishID
+}
+
+// setPendingPledge marks a user as pending pledge.
+// Releases the user beforehand.
+func (s *botState) setPendingPledge(userID int64, wishID int64) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending pledge", "user_id", userID)
+	s.PendingPledge[userID] = wishID
+}
+
+// setPendingWishURLUpdate marks a user as pending wish url update.
+// Releases the user beforehand.
+func (s *botState) setPendingWishURLUpdate(userID int64, wishID int64) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending wish url update", "user_id", userID)
+	s.PendingWishURLUpdate[userID] = wishID
+}
+
+// setPendingDuplicateWish keeps a duplicate wish until the user confirms adding it.
+// Releases the user beforehand.
+func (s *botState) setPendingDuplicateWish(userID int64, wish *pendingWish) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending duplicate wish", "user_id", userID)
+	s.PendingDuplicateWish[userID] = wish
+}
+
+// setPendingPurchase marks a user as pending purchase.
+// Releases the user beforehand.
+func (s *botState) setPendingPurchase(userID int64, wishID int64) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending purchase", "user_id", userID)
+	s.PendingPurchase[userID] = wishID
+}
+
+// setPendingTemplateCreation marks a user as pending template creation.
+// Releases the user beforehand.
+func (s *botState) setPendingTemplateCreation(userID int64) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending template creation", "user_id", userID)
+	s.PendingTemplateCreation[userID] = true
+}
+
+// setPendingProfileEdit marks a user as pending profile edit.
+// Releases the user beforehand.
+func (s *botState) setPendingProfileEdit(userID int64, edit *profileEdit) {
+	s.releaseUser(userID)
+	logger.Sugared.Infow("setting pending profile edit", "user_id", userID, "field", edit.field)
+	s.PendingProfileEdit[userID] = edit
+}
+
 // getPendingInviteCreation returns the group id for a user that is pending invite creation.
 func getPendingInviteCreation(userID int64) (int64, bool) {
 	groupID, ok := State.PendingInviteCreation[userID]
@@ -78,10 +204,68 @@ func getPendingWishCreation(userID int64) (int64, bool) {
 	return groupID, ok
 }
 
+// getPendingPoolCreation returns the wish id for a user that is pending pool creation.
+func getPendingPoolCreation(userID int64) (int64, bool) {
+	wishID, ok := State.PendingPoolCreation[userID]
+	return wishID, ok
+}
+
+// getPendingPledge returns the wish id for a user that is pending pledge.
+func getPendingPledge(userID int64) (int64, bool) {
+	wishID, ok := State.PendingPledge[userID]
+	return wishID, ok
+}
+
+// getPendingWishURLUpdate returns the wish id for a user that is pending wish url update.
+func getPendingWishURLUpdate(userID int64) (int64, bool) {
+	wishID, ok := State.PendingWishURLUpdate[userID]
+	return wishID, ok
+}
+
+// getPendingDuplicateWish returns the wish a user is confirming to add.
+func getPendingDuplicateWish(userID int64) (*pendingWish, bool) {
+	wish, ok := State.PendingDuplicateWish[userID]
+	return wish, ok
+}
+
+// getPendingPurchase returns the wish id for a user that is pending purchase.
+func getPendingPurchase(userID int64) (int64, bool) {
+	wishID, ok := State.PendingPurchase[userID]
+	return wishID, ok
+}
+
+// getPendingProfileEdit returns the profile field a user is sending a value for.
+func getPendingProfileEdit(userID int64) (*profileEdit, bool) {
+	edit, ok := State.PendingProfileEdit[userID]
+	return edit, ok
+}
+
+// pendingCount returns the amount of pending flows of all users.
+// Every map released in releaseUser must be counted here.
+func (s *botState) pendingCount() int {
+	return len(s.PendingGroupCreation) +
+		len(s.PendingInviteCreation) +
+		len(s.PendingWishCreation) +
+		len(s.PendingPoolCreation) +
+		len(s.PendingPledge) +
+		len(s.PendingWishURLUpdate) +
+		len(s.PendingDuplicateWish) +
+		len(s.PendingPurchase) +
+		len(s.PendingTemplateCreation) +
+		len(s.PendingProfileEdit)
+}
+
 // releaseUser releases a user from pending flows.
 func (s *botState) releaseUser(userID int64) {
 	logger.Sugared.Infow("releasing user", "user_id", userID)
 	delete(s.PendingGroupCreation, userID)
 	delete(s.PendingInviteCreation, userID)
 	delete(s.PendingWishCreation, userID)
+	delete(s.PendingPoolCreation, userID)
+	delete(s.PendingPledge, userID)
+	delete(s.PendingWishURLUpdate, userID)
+	delete(s.PendingDuplicateWish, userID)
+	delete(s.PendingPurchase, userID)
+	delete(s.PendingTemplateCreation, userID)
+	delete(s.PendingProfileEdit, userID)
 }
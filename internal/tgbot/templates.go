@@ -0,0 +1,290 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// TEMPLATE_CALLBACK_PREFIX is followed by the template id and optionally an action, e.g. "template:1:group:2".
+// Without a template id it opens the list of templates, "template:new" starts a new one.
+const TEMPLATE_CALLBACK_PREFIX = "template:"
+
+// Template callback actions.
+const (
+	TEMPLATE_NEW    = "new"
+	TEMPLATE_GROUP  = "group"
+	TEMPLATE_DELETE = "delete"
+)
+
+// TEMPLATE_NAME_LIMIT limits the length of template names, they are shown on buttons.
+const TEMPLATE_NAME_LIMIT = 64
+
+// TEMPLATE_TEXT_LIMIT limits the length of template texts, attached templates are repeated on every page of a wish list.
+const TEMPLATE_TEXT_LIMIT = 500
+
+func handleTemplates(ctx *handleContext) error {
+	return sendTemplateList(ctx, ctx.msg.Chat.ID, 0)
+}
+
+func handleTemplateCallback(ctx *handleContext) error {
+	data := ctx.callbackQuery.Data[len(TEMPLATE_CALLBACK_PREFIX):]
+	chatID := ctx.callbackQuery.Message.Chat.ID
+	messageID := ctx.callbackQuery.Message.MessageID
+
+	switch data {
+	case "":
+		return sendTemplateList(ctx, chatID, messageID)
+	case TEMPLATE_NEW:
+		State.setPendingTemplateCreation(ctx.user.UserID)
+		sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "sendTemplateData",
+			},
+		), "", nil)
+		return nil
+	}
+
+	payload := strings.Split(data, ":")
+	templateID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	template, err := db.GetTemplate(templateID)
+	if err == sql.ErrNoRows {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "templateNotFound",
+			},
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if template.UserID != ctx.user.UserID {
+		logger.Sugared.Errorw("not the owner of the template", "template_id", templateID, "user_id", ctx.user.UserID)
+		return nil
+	}
+
+	switch {
+	case len(payload) == 1:
+
+	case len(payload) == 2 && payload[1] == TEMPLATE_DELETE:
+		return sendAreYouSure(&areYouSureConfig{
+			localizer: ctx.localizer,
+			chatID:    chatID,
+			message: ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "deleteTemplate",
+					TemplateData: map[string]any{
+						"TemplateName": html.EscapeString(template.Name),
+					},
+				},
+			),
+			actionID:     DELETE_TEMPLATE_ACTION,
+			callbackData: fmt.Sprintf("%d", template.TemplateID),
+			messageID:    messageID,
+		})
+
+	case len(payload) == 3 && payload[1] == TEMPLATE_GROUP:
+		groupID, err := strconv.ParseInt(payload[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		if _, err := db.GetGroupMember(groupID, ctx.user.UserID); err != nil {
+			return err
+		}
+		groupIDs, err := db.GetTemplateGroupIDs(template.TemplateID)
+		if err != nil {
+			return err
+		}
+		if err := db.SetTemplateAttached(template.TemplateID, groupID, !slices.Contains(groupIDs, groupID)); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("invalid template callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	return sendTemplateMenu(ctx, chatID, messageID, template)
+}
+
+// sendTemplateList sends the templates of the user with a button to add a new one.
+// If messageID is not 0, the message is edited in place instead.
+func sendTemplateList(ctx *handleContext, chatID int64, messageID int) error {
+	templates, err := db.GetUserTemplates(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, template := range templates {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"📎 "+template.Name,
+			fmt.Sprintf("%s%d", TEMPLATE_CALLBACK_PREFIX, template.TemplateID),
+		)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+		ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "newTemplate",
+			},
+		),
+		TEMPLATE_CALLBACK_PREFIX+TEMPLATE_NEW,
+	)))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	config := &i18n.LocalizeConfig{MessageID: "templatesMenu"}
+	if len(templates) == 0 {
+		config = &i18n.LocalizeConfig{MessageID: "noTemplates"}
+	}
+	sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(config), "", &keyboard)
+
+	return nil
+}
+
+// sendTemplateMenu sends a template with buttons attaching it to the groups of the user.
+// If messageID is not 0, the message is edited in place instead.
+func sendTemplateMenu(ctx *handleContext, chatID int64, messageID int, template *db.WishTemplate) error {
+	groups, err := db.GetUserGroups(ctx.user.UserID)
+	if err != nil {
+		return err
+	}
+	groupIDs, err := db.GetTemplateGroupIDs(template.TemplateID)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		label := group.Name
+		if slices.Contains(groupIDs, group.GroupID) {
+			label = "✓ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			label,
+			fmt.Sprintf("%s%d:%s:%d", TEMPLATE_CALLBACK_PREFIX, template.TemplateID, TEMPLATE_GROUP, group.GroupID),
+		)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "backToList",
+				},
+			),
+			TEMPLATE_CALLBACK_PREFIX,
+		),
+		tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "deleteWishButton",
+				},
+			),
+			fmt.Sprintf("%s%d:%s", TEMPLATE_CALLBACK_PREFIX, template.TemplateID, TEMPLATE_DELETE),
+		),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "templateMenu",
+			TemplateData: map[string]any{
+				"TemplateText": formatTemplate(template),
+			},
+		},
+	), "", &keyboard)
+
+	return nil
+}
+
+func handleCreatingTemplateFlow(ctx *handleContext) error {
+	name, text, _ := strings.Cut(strings.TrimSpace(ctx.msg.Text), "\n")
+	name = strings.TrimSpace(name)
+	text = strings.TrimSpace(text)
+
+	if name == "" || text == "" ||
+		utf8.RuneCountInString(name) > TEMPLATE_NAME_LIMIT || utf8.RuneCountInString(text) > TEMPLATE_TEXT_LIMIT {
+		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "errorTemplateData",
+				TemplateData: map[string]any{
+					"NameLimit": TEMPLATE_NAME_LIMIT,
+					"TextLimit": TEMPLATE_TEXT_LIMIT,
+				},
+			},
+		))
+		bot.HandledSend(resp)
+		return nil
+	}
+
+	template, err := db.CreateTemplate(ctx.user.UserID, name, text)
+	if err != nil {
+		State.releaseUser(ctx.msg.From.ID)
+		return err
+	}
+
+	State.releaseUser(ctx.msg.From.ID)
+
+	return sendTemplateMenu(ctx, ctx.msg.Chat.ID, 0, template)
+}
+
+func handleDeleteTemplate(dataOffset int, ctx *handleContext) error {
+	templateID, err := strconv.ParseInt(ctx.callbackQuery.Data[dataOffset:], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	template, err := db.GetTemplate(templateID)
+	if err != nil {
+		return err
+	}
+	if template.UserID != ctx.callbackQuery.From.ID {
+		logger.Sugared.Errorw("not the owner of the template", "template_id", templateID, "user_id", ctx.callbackQuery.From.ID)
+		return nil
+	}
+
+	if err := db.DeleteTemplate(templateID); err != nil {
+		return err
+	}
+
+	edit := newCallbackEdit(ctx, ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "templateDeleted",
+		},
+	))
+	bot.HandledSend(edit)
+
+	return nil
+}
+
+// getMemberTemplatesText renders the templates a member attached to a group, empty if there are none.
+func getMemberTemplatesText(groupID int64, userID int64) string {
+	templates, err := db.GetMemberTemplates(groupID, userID)
+	if err != nil {
+		logger.Sugared.Errorw("failed to get member templates", "group_id", groupID, "user_id", userID, "err", err)
+		return ""
+	}
+
+	parts := make([]string, len(templates))
+	for idx, template := range templates {
+		parts[idx] = formatTemplate(template)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// formatTemplate renders a template, e.g. "📎 My sizes\nT-shirt: M".
+func formatTemplate(template *db.WishTemplate) string {
+	return fmt.Sprintf("📎 %s\n%s", template.Name, template.Text)
+}
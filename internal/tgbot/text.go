@@ -17,21 +17,38 @@ func handleText(ctx *handleContext) error {
 
 	var err error
 
-	if State.isPendingGroupCreation(ctx.msg.From.ID) {
+	// a flow may move the user to the next pending flow, so only one of them is handled per message
+	switch {
+	case State.isPendingGroupCreation(ctx.msg.From.ID):
 		err = handleCreatingGroupFlow(ctx)
-	}
-	if State.isPendingInviteCreation(ctx.msg.From.ID) {
+	case State.isPendingInviteCreation(ctx.msg.From.ID):
 		err = handleCreatingInviteFlow(ctx)
-	}
-	if State.isPendingWishCreation(ctx.msg.From.ID) {
+	case State.isPendingWishCreation(ctx.msg.From.ID):
 		err = handleCreatingWishFlow(ctx)
+	case State.isPendingPoolCreation(ctx.msg.From.ID):
+		err = handleCreatingPoolFlow(ctx)
+	case State.isPendingPledge(ctx.msg.From.ID):
+		err = handlePledgeFlow(ctx)
+	case State.isPendingWishURLUpdate(ctx.msg.From.ID):
+		err = handleUpdatingWishURLFlow(ctx)
+	case State.isPendingPurchase(ctx.msg.From.ID):
+		err = handlePurchaseFlow(ctx)
+	case State.isPendingTemplateCreation(ctx.msg.From.ID):
+		err = handleCreatingTemplateFlow(ctx)
+	case State.isPendingProfileEdit(ctx.msg.From.ID):
+		err = handleProfileEditFlow(ctx)
 	}
 
 	return err
 }
 
 func handleCreatingGroupFlow(ctx *handleContext) error {
-	group, err := db.CreateGroup(ctx.msg.From.ID, ctx.msg.Text)
+	return createGroup(ctx, ctx.msg.Text)
+}
+
+// createGroup creates a group owned by the user who sent the message.
+func createGroup(ctx *handleContext, name string) error {
+	group, err := db.CreateGroup(ctx.msg.From.ID, name)
 	if err != nil {
 		return err
 	}
@@ -139,7 +156,7 @@ func handleCreatingInviteFlow(ctx *handleContext) error {
 						&i18n.LocalizeConfig{
 							MessageID: "alreadyAMember",
 							TemplateData: map[string]any{
-								"Username": user.Username,
+								"Username": user.DisplayName(),
 							},
 						},
 					),
@@ -169,7 +186,7 @@ func handleCreatingInviteFlow(ctx *handleContext) error {
 						&i18n.LocalizeConfig{
 							MessageID: "errorInvitingUser",
 							TemplateData: map[string]any{
-								"Username": "@" + user.Username,
+								"Username": user.DisplayName(),
 							},
 						},
 					),
@@ -178,7 +195,7 @@ func handleCreatingInviteFlow(ctx *handleContext) error {
 			} else {
 				// notify the user if everything went fine
 				logger.Sugared.Infow("invited user", "user_id", user.UserID, "chat_id", user.ChatID)
-				resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, fmt.Sprintf("Invited %s", user.Username))
+				resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, fmt.Sprintf("Invited %s", user.DisplayName()))
 				bot.HandledSend(resp)
 			}
 		}()
@@ -196,18 +213,7 @@ func handleCreatingWishFlow(ctx *handleContext) error {
 		return fmt.Errorf("user is not pending wish creation")
 	}
 
-	wishURL := ""
-	descriptionOffset := 0
-	for _, entity := range ctx.msg.Entities {
-		if entity.Type == "url" || entity.Type == "text_link" {
-			if entity.Type == "text_link" {
-				wishURL = entity.URL
-			} else {
-				wishURL = ctx.msg.Text[entity.Offset : entity.Offset+entity.Length]
-			}
-			descriptionOffset = entity.Offset + entity.Length
-		}
-	}
+	wishURL, descriptionOffset := getMessageURL(ctx.msg)
 
 	if wishURL == "" {
 		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
@@ -224,16 +230,70 @@ func handleCreatingWishFlow(ctx *handleContext) error {
 		description = strings.TrimSpace(ctx.msg.Text[descriptionOffset:])
 	}
 
+	return createWish(ctx, groupID, wishURL, description)
+}
+
+// getMessageURL returns the last link of a message and the offset of the text following it.
+// Returns an empty url if the message has no links.
+func getMessageURL(msg *tgbotapi.Message) (string, int) {
+	url := ""
+	offset := 0
+	for _, entity := range msg.Entities {
+		if entity.Type == "url" || entity.Type == "text_link" {
+			if entity.Type == "text_link" {
+				url = entity.URL
+			} else {
+				url = msg.Text[entity.Offset : entity.Offset+entity.Length]
+			}
+			offset = entity.Offset + entity.Length
+		}
+	}
+	return url, offset
+}
+
+// normalizeWishURL canonicalizes a wish url and strips tracking parameters from it.
+// Urls the normalizer can't handle are kept as sent.
+func normalizeWishURL(wishURL string) string {
+	normalized, err := wishURLNormalizer.Normalize(wishURL)
+	if err != nil {
+		logger.Sugared.Warnw("failed to normalize wish url", "url", wishURL, "err", err)
+		return wishURL
+	}
+	return normalized
+}
+
+// createWish creates a wish for the user who sent the message and notifies the group.
+// If the user already wished for the same thing in the group, they are asked to confirm first.
+func createWish(ctx *handleContext, groupID int64, wishURL string, description string) error {
 	logger.Sugared.Debugw("creating wish", "wish_url", wishURL, "description", description)
 
-	wish, err := db.CreateWish(wishURL, description, ctx.msg.From.ID, groupID)
+	wishURL = normalizeWishURL(wishURL)
+
+	duplicates, err := findDuplicateWishes(groupID, wishURL, description)
+	if err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		if duplicate.UserID == ctx.user.UserID {
+			return askAddDuplicateWish(ctx, groupID, wishURL, description, duplicate)
+		}
+	}
+
+	return addWish(ctx, 0, groupID, wishURL, description, duplicates)
+}
+
+// addWish stores a wish of the user and notifies the group.
+// Members are quietly told when other members wish for the same thing, see findDuplicateWishes.
+// If messageID is not 0, that message is edited into the confirmation instead of sending a new one.
+func addWish(ctx *handleContext, messageID int, groupID int64, wishURL string, description string, duplicates []*db.Wish) error {
+	wish, err := db.CreateWish(wishURL, description, ctx.user.UserID, groupID)
 	if err != nil {
 		return err
 	}
 
 	group, err := db.GetGroup(groupID)
 	if err != nil {
-		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		resp := tgbotapi.NewMessage(ctx.user.ChatID, ctx.localizer.MustLocalize(
 			&i18n.LocalizeConfig{
 				MessageID: "errorWishGroupNotification",
 			},
@@ -242,9 +302,25 @@ func handleCreatingWishFlow(ctx *handleContext) error {
 		return nil
 	}
 
-	members, err := db.GetGroupMembers(groupID)
+	err = notifyGroupWish(group, ctx.user.UserID, func(localizer *locals.Localizer) string {
+		return fmt.Sprintf(
+			"%s\n\n%s\n\n%s",
+			localizer.MustLocalize(
+				&i18n.LocalizeConfig{
+					MessageID: "wishCreatedGroupNotification",
+					TemplateData: map[string]any{
+						"Username":  ctx.user.FirstName,
+						"GroupName": group.Name,
+					},
+				},
+			),
+			wish.URL,
+			wish.Description,
+		)
+	})
 	if err != nil {
-		resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+		logger.Sugared.Errorw("failed to notify group about new wish", "group_id", groupID, "err", err)
+		resp := tgbotapi.NewMessage(ctx.user.ChatID, ctx.localizer.MustLocalize(
 			&i18n.LocalizeConfig{
 				MessageID: "errorWishGroupNotification",
 			},
@@ -253,53 +329,14 @@ func handleCreatingWishFlow(ctx *handleContext) error {
 		return nil
 	}
 
-	for _, member := range members {
-		if member.UserID == ctx.msg.From.ID {
-			continue
-		}
-
-		go func() {
-			user, err := db.GetUser(member.UserID)
-			if err != nil {
-				logger.Sugared.Errorw("error getting user for notification", "user_id", member.UserID, "error", err)
-				return
-			}
-
-			userLocalizer := locals.GetLocalizer(user.Language)
+	notifySameWish(group, ctx.user, wish, duplicates)
 
-			msg := tgbotapi.NewMessage(
-				user.ChatID,
-				userLocalizer.MustLocalize(
-					&i18n.LocalizeConfig{
-						MessageID: "wishCreatedGroupNotification",
-						TemplateData: map[string]any{
-							"Username":  ctx.msg.From.FirstName,
-							"GroupName": group.Name,
-						},
-					},
-				),
-			)
-			bot.HandledSend(msg)
-
-			wishMsg := tgbotapi.NewMessage(
-				user.ChatID,
-				fmt.Sprintf(
-					"%s\n\n%s",
-					wish.URL,
-					wish.Description,
-				),
-			)
-			bot.HandledSend(wishMsg)
-		}()
-	}
-
-	resp := tgbotapi.NewMessage(ctx.msg.Chat.ID, ctx.localizer.MustLocalize(
+	sendOrEditMessage(ctx.user.ChatID, messageID, ctx.localizer.MustLocalize(
 		&i18n.LocalizeConfig{
 			MessageID: "wishCreatedNotification",
 		},
-	))
-	bot.HandledSend(resp)
+	), "", nil)
 
-	State.releaseUser(ctx.msg.From.ID)
+	State.releaseUser(ctx.user.UserID)
 	return nil
 }
@@ -2,6 +2,9 @@ package tgbot
 
 import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+// MESSAGE_TEXT_LIMIT is the maximum length of a Telegram message text.
+const MESSAGE_TEXT_LIMIT = 4096
+
 // getMentions extracts all mentions from a message.
 // text_mention and mention are both valid types.
 func getMentions(msg *tgbotapi.Message) []tgbotapi.MessageEntity {
@@ -13,3 +16,12 @@ func getMentions(msg *tgbotapi.Message) []tgbotapi.MessageEntity {
 	}
 	return mentions
 }
+
+// truncateText shortens a text to at most limit characters, marking the cut with an ellipsis.
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,318 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// WISH_LIST_CALLBACK_PREFIX is followed by the list kind, the group id and the page, e.g. "wish_list:view:1:2".
+const WISH_LIST_CALLBACK_PREFIX = "wish_list:"
+
+// Wish list kinds.
+const (
+	// WISH_LIST_VIEW lists the wishes of all group members.
+	WISH_LIST_VIEW = "view"
+	// WISH_LIST_MANAGE lists the user's own wishes with buttons opening their menus.
+	WISH_LIST_MANAGE = "manage"
+)
+
+func handleWishListCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(WISH_LIST_CALLBACK_PREFIX):], ":")
+	if len(payload) != 3 || (payload[0] != WISH_LIST_VIEW && payload[0] != WISH_LIST_MANAGE) {
+		return fmt.Errorf("invalid wish list callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	groupID, err := strconv.ParseInt(payload[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	page, err := strconv.Atoi(payload[2])
+	if err != nil {
+		return err
+	}
+
+	group, err := db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	return sendWishList(
+		ctx,
+		ctx.callbackQuery.Message.Chat.ID,
+		ctx.callbackQuery.Message.MessageID,
+		group,
+		payload[0],
+		page,
+	)
+}
+
+// sendWishList sends a page of a wish list of the group.
+// If messageID is not 0, the message is edited in place instead.
+func sendWishList(ctx *handleContext, chatID int64, messageID int, group *db.Group, kind string, page int) error {
+	// the user may have left the group since the list was sent
+	if _, err := db.GetGroupMember(group.GroupID, ctx.user.UserID); err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+		logger.Sugared.Errorw("not a member of the group", "group_id", group.GroupID, "user_id", ctx.user.UserID)
+		sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "notGroupMember",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		), "", nil)
+		return nil
+	}
+
+	var list *pagedList
+	var err error
+	switch kind {
+	case WISH_LIST_MANAGE:
+		list, err = getManageWishList(ctx, group)
+	default:
+		list, err = getViewWishList(ctx, group)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(list.pages) == 0 {
+		sendOrEditMessage(chatID, messageID, ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "noWishes",
+				TemplateData: map[string]any{
+					"GroupName": group.Name,
+				},
+			},
+		), "", nil)
+		return nil
+	}
+
+	text, keyboard := list.render(ctx.localizer, page, func(page int) string {
+		return fmt.Sprintf("%s%s:%d:%d", WISH_LIST_CALLBACK_PREFIX, kind, group.GroupID, page)
+	})
+	sendOrEditMessage(chatID, messageID, text, "", keyboard)
+
+	return nil
+}
+
+// getManageWishList returns the pages of the user's own wishes in the group.
+func getManageWishList(ctx *handleContext, group *db.Group) (*pagedList, error) {
+	items, err := getManageWishItems(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	header := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "hereAreYourWishes",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	)
+	return newPagedList(header, items), nil
+}
+
+// getManageWishItems lists the user's own wishes in the group, each with a button opening its menu.
+func getManageWishItems(ctx *handleContext, group *db.Group) ([]listItem, error) {
+	wishes, err := db.GetUserWishes(ctx.user.UserID, group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]listItem, len(wishes))
+	for idx, wish := range wishes {
+		button := tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("✏️ %d", idx+1),
+			fmt.Sprintf("%s%d", WISH_MENU_CALLBACK_PREFIX, wish.WishID),
+		)
+		items[idx] = listItem{
+			text:   formatWishItem(idx+1, wish),
+			button: &button,
+		}
+		if wishPrice := getWishPrice(ctx.localizer, wish.WishID); wishPrice != "" {
+			items[idx].text += "\n" + wishPrice
+		}
+		if warning := getWishLinkWarning(ctx.localizer, wish.WishID); warning != "" {
+			items[idx].text += "\n" + warning
+		}
+	}
+
+	return items, nil
+}
+
+// getViewWishList returns the pages of the group wish list as the user sees them.
+func getViewWishList(ctx *handleContext, group *db.Group) (*pagedList, error) {
+	items, err := getViewWishItems(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	header := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "hereAreWishes",
+			TemplateData: map[string]any{
+				"GroupName": group.Name,
+			},
+		},
+	)
+	return newPagedList(header, items), nil
+}
+
+// getViewWishItems lists all wishes of the group sectioned by their owners, the user's own wishes first.
+// Every member gets a section, members without wishes are listed with a placeholder.
+// Wishes of other members get a button opening their gift menu.
+func getViewWishItems(ctx *handleContext, group *db.Group) ([]listItem, error) {
+	members, err := db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	wishes, err := db.GetGroupWishes(group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberWishes := make(map[int64][]*db.Wish)
+	for _, wish := range wishes {
+		memberWishes[wish.UserID] = append(memberWishes[wish.UserID], wish)
+	}
+
+	sortOwnMemberFirst(members, ctx.user.UserID)
+
+	var items []listItem
+	number := 0
+	for _, member := range members {
+		section := getWishListSection(ctx, group.GroupID, member.UserID)
+
+		if len(memberWishes[member.UserID]) == 0 {
+			items = append(items, listItem{
+				section: section,
+				userID:  member.UserID,
+				text: ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "memberNoWishes",
+					},
+				),
+			})
+			continue
+		}
+
+		for _, wish := range memberWishes[member.UserID] {
+			number++
+			item := listItem{
+				section: section,
+				text:    formatWishItem(number, wish),
+				userID:  member.UserID,
+				wishID:  wish.WishID,
+			}
+			if wishPrice := getWishPrice(ctx.localizer, wish.WishID); wishPrice != "" {
+				item.text += "\n" + wishPrice
+			}
+
+			// pool progress is a surprise for the wish owner
+			if wish.UserID != ctx.user.UserID {
+				if progress := getPoolProgress(ctx.localizer, wish.WishID); progress != "" {
+					item.text += "\n" + progress
+				}
+				button := tgbotapi.NewInlineKeyboardButtonData(
+					fmt.Sprintf("🎁 %d", number),
+					fmt.Sprintf("%s%d", GIFT_MENU_CALLBACK_PREFIX, wish.WishID),
+				)
+				item.button = &button
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// sortOwnMemberFirst moves the user to the top of the members, keeping the order otherwise.
+func sortOwnMemberFirst(members []*db.GroupMember, userID int64) {
+	slices.SortStableFunc(members, func(a, b *db.GroupMember) int {
+		aOwn, bOwn := a.UserID == userID, b.UserID == userID
+		switch {
+		case aOwn && !bOwn:
+			return -1
+		case !aOwn && bOwn:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// getViewWishNumber returns the number a wish is shown with in the group wish list, 0 if it is not listed.
+func getViewWishNumber(list *pagedList, wishID int64) int {
+	number := 0
+	for _, page := range list.pages {
+		for _, item := range page {
+			if item.wishID == 0 {
+				continue
+			}
+			number++
+			if item.wishID == wishID {
+				return number
+			}
+		}
+	}
+	return 0
+}
+
+// getWishListSection returns the title above the wishes of a group member,
+// followed by their profile and the templates they attached to the group.
+func getWishListSection(ctx *handleContext, groupID int64, userID int64) string {
+	var title string
+	if userID == ctx.user.UserID {
+		title = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "yourWishes",
+			},
+		)
+	} else {
+		title = getMemberWishesTitle(ctx, userID)
+	}
+
+	if profile := getProfileText(ctx.localizer, userID); profile != "" {
+		title += "\n" + profile
+	}
+	if templates := getMemberTemplatesText(groupID, userID); templates != "" {
+		title += "\n" + templates
+	}
+	return title
+}
+
+func getMemberWishesTitle(ctx *handleContext, userID int64) string {
+	name := "?"
+	if user, err := db.GetUser(userID); err == nil {
+		name = user.DisplayName()
+	} else {
+		logger.Sugared.Errorw("failed to get user for wishes display", "user_id", userID, "err", err)
+	}
+
+	return ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "userWishes",
+			TemplateData: map[string]any{
+				"Username": name,
+			},
+		},
+	)
+}
+
+func formatWishItem(number int, wish *db.Wish) string {
+	return strings.TrimSpace(fmt.Sprintf("%d. %s\n%s", number, wish.URL, wish.Description))
+}
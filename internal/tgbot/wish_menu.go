@@ -0,0 +1,178 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aybolid/wishbot/internal/db"
+	"github.com/aybolid/wishbot/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// WISH_MENU_CALLBACK_PREFIX is followed by the wish id, e.g. "wish_menu:1".
+const WISH_MENU_CALLBACK_PREFIX = "wish_menu:"
+
+// MOVE_WISH_CALLBACK_PREFIX is followed by the wish id and the direction, e.g. "move_wish:1:up".
+const MOVE_WISH_CALLBACK_PREFIX = "move_wish:"
+
+// Wish move directions.
+const (
+	MOVE_WISH_UP   = "up"
+	MOVE_WISH_DOWN = "down"
+	MOVE_WISH_TOP  = "top"
+)
+
+func handleWishMenuCallback(ctx *handleContext) error {
+	wishID, err := strconv.ParseInt(ctx.callbackQuery.Data[len(WISH_MENU_CALLBACK_PREFIX):], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	wish, ok, err := getOwnWish(ctx, wishID)
+	if err != nil || !ok {
+		return err
+	}
+
+	return sendWishMenu(ctx, wish)
+}
+
+func handleMoveWishCallback(ctx *handleContext) error {
+	payload := strings.Split(ctx.callbackQuery.Data[len(MOVE_WISH_CALLBACK_PREFIX):], ":")
+	if len(payload) != 2 {
+		return fmt.Errorf("invalid move wish callback data: %s", ctx.callbackQuery.Data)
+	}
+
+	wishID, err := strconv.ParseInt(payload[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var offset int
+	switch payload[1] {
+	case MOVE_WISH_UP:
+		offset = -1
+	case MOVE_WISH_DOWN:
+		offset = 1
+	case MOVE_WISH_TOP:
+		// offsets are clamped to the list
+		offset = math.MinInt
+	default:
+		return fmt.Errorf("invalid move wish direction: %s", payload[1])
+	}
+
+	wish, ok, err := getOwnWish(ctx, wishID)
+	if err != nil || !ok {
+		return err
+	}
+
+	if _, err := db.MoveWish(wish.WishID, offset); err != nil {
+		return err
+	}
+
+	return sendWishMenu(ctx, wish)
+}
+
+// getOwnWish returns a wish of the user who pressed a button.
+// Returns false if the wish is gone or belongs to someone else, the user is told with a toast.
+func getOwnWish(ctx *handleContext, wishID int64) (*db.Wish, bool, error) {
+	wish, err := db.GetWish(wishID)
+	if err == sql.ErrNoRows {
+		ctx.callbackAnswer = ctx.localizer.MustLocalize(
+			&i18n.LocalizeConfig{
+				MessageID: "wishNotFound",
+			},
+		)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if wish.UserID != ctx.callbackQuery.From.ID {
+		logger.Sugared.Errorw("not the owner of the wish", "wish_id", wishID, "user_id", ctx.callbackQuery.From.ID)
+		return nil, false, nil
+	}
+
+	return wish, true, nil
+}
+
+// sendWishMenu edits the message the callback query came from into the actions of a wish.
+func sendWishMenu(ctx *handleContext, wish *db.Wish) error {
+	group, err := db.GetGroup(wish.GroupID)
+	if err != nil {
+		return err
+	}
+	wishes, err := db.GetUserWishes(wish.UserID, wish.GroupID)
+	if err != nil {
+		return err
+	}
+
+	number := slices.IndexFunc(wishes, func(w *db.Wish) bool { return w.WishID == wish.WishID }) + 1
+
+	text := ctx.localizer.MustLocalize(
+		&i18n.LocalizeConfig{
+			MessageID: "wishMenu",
+			TemplateData: map[string]any{
+				"Number":    number,
+				"Count":     len(wishes),
+				"GroupName": group.Name,
+				"WishText":  strings.TrimSpace(wish.URL + "\n" + wish.Description),
+			},
+		},
+	)
+
+	moveButton := func(config *i18n.LocalizeConfig, direction string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(
+			ctx.localizer.MustLocalize(config),
+			fmt.Sprintf("%s%d:%s", MOVE_WISH_CALLBACK_PREFIX, wish.WishID, direction),
+		)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(wishes) > 1 {
+		var moveRow []tgbotapi.InlineKeyboardButton
+		if number > 1 {
+			moveRow = append(moveRow, moveButton(&i18n.LocalizeConfig{MessageID: "moveWishUp"}, MOVE_WISH_UP))
+		}
+		if number < len(wishes) {
+			moveRow = append(moveRow, moveButton(&i18n.LocalizeConfig{MessageID: "moveWishDown"}, MOVE_WISH_DOWN))
+		}
+		rows = append(rows, moveRow)
+		if number > 2 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(moveButton(&i18n.LocalizeConfig{MessageID: "moveWishTop"}, MOVE_WISH_TOP)))
+		}
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "deleteWishButton",
+					},
+				),
+				fmt.Sprintf("%s%d", DELETE_WISH_CALLBACK_PREFIX, wish.WishID),
+			),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				ctx.localizer.MustLocalize(
+					&i18n.LocalizeConfig{
+						MessageID: "backToList",
+					},
+				),
+				// the page is a guess, pages also break on long wishes
+				fmt.Sprintf("%s%s:%d:%d", WISH_LIST_CALLBACK_PREFIX, WISH_LIST_MANAGE, wish.GroupID, (number-1)/LIST_PAGE_SIZE),
+			),
+		),
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	sendOrEditMessage(ctx.callbackQuery.Message.Chat.ID, ctx.callbackQuery.Message.MessageID, text, "", &keyboard)
+
+	return nil
+}
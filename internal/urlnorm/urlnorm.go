@@ -0,0 +1,219 @@
+// Package urlnorm canonicalizes wish urls, so the same page is always stored the same way
+// and referral info of the sender is not shared with the group.
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidURL = errors.New("invalid url")
+
+// Rule describes query parameters to strip from urls.
+type Rule struct {
+	// Hosts the rule applies to, subdomains included. Empty applies to all hosts.
+	Hosts []string
+	// Params are the names of the parameters. A trailing "*" matches any suffix, e.g. "utm_*".
+	Params []string
+}
+
+// DefaultRules strip common analytics, ad click and affiliate parameters.
+var DefaultRules = []Rule{
+	{
+		Params: []string{
+			"utm_*", "fbclid", "gclid", "gclsrc", "dclid", "gbraid", "wbraid", "msclkid", "yclid",
+			"twclid", "ttclid", "igshid", "mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi",
+			"mkt_tok", "oly_anon_id", "oly_enc_id", "vero_id", "rb_clickid", "s_cid",
+		},
+	},
+	{
+		Hosts:  []string{"amazon.com", "amazon.de", "amazon.co.uk", "amazon.fr", "amazon.it", "amazon.es", "amazon.pl", "amazon.ca", "amazon.co.jp"},
+		Params: []string{"tag", "ref", "ref_", "ascsubtag", "linkcode", "linkid", "creative", "creativeasin", "camp", "pd_rd_*", "pf_rd_*", "content-id", "psc", "sr", "qid", "keywords", "dib", "dib_tag", "crid", "sprefix"},
+	},
+	{
+		Hosts:  []string{"aliexpress.com", "aliexpress.ru", "aliexpress.us"},
+		Params: []string{"aff_*", "spm", "scm", "scm_*", "algo_*", "pdp_*", "sk", "gatewayadapt", "afsmartredirect", "terminal_id", "srcsns", "social_params", "tt", "businesstype", "platform", "channel"},
+	},
+	{
+		Hosts:  []string{"ebay.com", "ebay.de", "ebay.co.uk"},
+		Params: []string{"mkcid", "mkrid", "mkevt", "campid", "customid", "toolid", "_trkparms", "_trksid", "hash", "amdata"},
+	},
+	{
+		Hosts:  []string{"rozetka.com.ua", "prom.ua", "olx.ua"},
+		Params: []string{"gad_source", "srsltid", "ref", "source"},
+	},
+	{
+		Hosts:  []string{"youtube.com"},
+		Params: []string{"si", "feature", "pp"},
+	},
+}
+
+// mobileHosts maps mobile site hosts to the hosts of the regular sites.
+var mobileHosts = map[string]string{
+	"m.aliexpress.com":   "aliexpress.com",
+	"m.aliexpress.ru":    "aliexpress.ru",
+	"m.ebay.com":         "ebay.com",
+	"m.ebay.de":          "ebay.de",
+	"m.ebay.co.uk":       "ebay.co.uk",
+	"m.youtube.com":      "youtube.com",
+	"m.facebook.com":     "facebook.com",
+	"mobile.twitter.com": "twitter.com",
+	"m.rozetka.com.ua":   "rozetka.com.ua",
+	"m.prom.ua":          "prom.ua",
+	"m.olx.ua":           "olx.ua",
+	"m.etsy.com":         "etsy.com",
+}
+
+var amazonProductPattern = regexp.MustCompile(`(?i)/(?:dp|gp/product|gp/aw/d)/([a-z0-9]{10})(?:[/?]|$)`)
+
+// Normalizer canonicalizes urls using a list of rules.
+type Normalizer struct {
+	rules []Rule
+}
+
+// New creates a normalizer stripping the parameters of the given rules.
+func New(rules []Rule) *Normalizer {
+	return &Normalizer{rules: rules}
+}
+
+// Normalize canonicalizes a url:
+//   - http is assumed if the scheme is missing, the scheme and host are lower cased,
+//     default ports and fragments are dropped;
+//   - mobile site hosts are replaced with the regular ones;
+//   - short links and product pages that can be resolved without a request are expanded or shortened,
+//     e.g. youtu.be/ID or amazon.com/Some-Title/dp/ID/ref=xyz;
+//   - tracking parameters are stripped and the remaining ones are sorted.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	// the scheme is lower cased by url.Parse
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", ErrInvalidURL
+	}
+
+	u.Host = normalizeHost(u)
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+
+	resolveShortLink(u)
+
+	query := u.Query()
+	for name := range query {
+		if n.isTracking(u.Hostname(), name) {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String(), nil
+}
+
+// isTracking reports whether a parameter of a url with the given host should be stripped.
+func (n *Normalizer) isTracking(host string, param string) bool {
+	param = strings.ToLower(param)
+	for _, rule := range n.rules {
+		if !matchesHost(rule.Hosts, host) {
+			continue
+		}
+		for _, pattern := range rule.Params {
+			pattern = strings.ToLower(pattern)
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+				if strings.HasPrefix(param, prefix) {
+					return true
+				}
+			} else if param == pattern {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesHost reports whether the host is one of the hosts or their subdomain.
+// An empty list matches every host.
+func matchesHost(hosts []string, host string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost lower cases the host, drops default ports and maps mobile hosts.
+// A "www." prefix is kept, some sites don't answer without it or serve another site on the bare domain.
+func normalizeHost(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if regular, ok := mobileHosts[host]; ok {
+		host = regular
+	}
+
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// Key returns a key for comparing normalized urls, e.g. to find duplicate wishes.
+// Urls differing only in a "www." prefix most likely point to the same page, so the prefix is ignored.
+func Key(normalized string) string {
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return normalized
+	}
+	if host, ok := strings.CutPrefix(u.Host, "www."); ok {
+		u.Host = host
+	}
+	return u.String()
+}
+
+// resolveShortLink rewrites links whose target is known without following them.
+// Short links of other services, e.g. amzn.to, need a request and are kept as is.
+func resolveShortLink(u *url.URL) {
+	host := u.Hostname()
+
+	switch {
+	case host == "youtu.be":
+		id := strings.Trim(u.Path, "/")
+		if id == "" || strings.Contains(id, "/") {
+			return
+		}
+		query := u.Query()
+		query.Set("v", id)
+		u.Host = "youtube.com"
+		u.Path = "/watch"
+		u.RawPath = ""
+		u.RawQuery = query.Encode()
+	case strings.HasPrefix(host, "amazon.") || strings.Contains(host, ".amazon."):
+		// product titles and ref path segments are decoration, the ASIN identifies the product
+		if match := amazonProductPattern.FindStringSubmatch(u.Path); match != nil {
+			u.Path = "/dp/" + strings.ToUpper(match[1])
+			u.RawPath = ""
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	// time zones of users must load on hosts without zoneinfo
+	_ "time/tzdata"
+
 	"github.com/aybolid/wishbot/internal/db"
 	"github.com/aybolid/wishbot/internal/env"
+	"github.com/aybolid/wishbot/internal/linkcheck"
 	"github.com/aybolid/wishbot/internal/locals"
 	"github.com/aybolid/wishbot/internal/logger"
+	"github.com/aybolid/wishbot/internal/price"
 	"github.com/aybolid/wishbot/internal/tgbot"
 )
 
@@ -18,5 +23,10 @@ func init() {
 
 func main() {
 	defer logger.Shutdown()
+	go tgbot.WatchPrices(price.NewHTTPFetcher(false))
+	go tgbot.WatchLinks(linkcheck.NewChecker(price.NewHTTPClient(false)))
+	go tgbot.WatchDigests()
+	go tgbot.WatchDeferredMessages()
+	go tgbot.WatchBirthdays()
 	tgbot.Listen()
 }